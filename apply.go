@@ -0,0 +1,425 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// CmdApply is run for the "apply" command.
+func CmdApply(args []string) {
+	fs := NewFlagSet("apply")
+	AddEnvFlag(fs)
+	yes := fs.Bool("yes", false, "Same as terraform's -auto-approve")
+	review := fs.Bool("review", false, "Plan, show a summary and ask for confirmation before applying the plan (the default without -yes)")
+	plan := fs.String("plan", "", "Apply a plan saved with plan --out: its file, its name or latest")
+	AddPolicyFlag(fs)
+	AddParallelFlag(fs)
+	AddInitFlag(fs)
+	AddVarFlags(fs)
+	positional, terraformArgs := ParseFlagsWithTerraformArgs(fs, args)
+
+	if *plan != "" && *review {
+		Error("--plan can't be used with --review, the saved plan was already reviewed")
+	}
+
+	if len(positional) > 0 && tf.IsPattern(positional[0]) {
+		if *plan != "" {
+			Error("--plan can only be used to apply a single component")
+		}
+		if *review && parallel > 1 {
+			Error("--parallel can't be used with --review, since the reviews can't be shown at the same time")
+		}
+		CheckParallel(*yes)
+
+		graph := PatternGraph(positional[0])
+		PrintComponents(fmt.Sprintf("These components match '%s' and will be applied, in this order", positional[0]), graph.Order())
+
+		ApplyGraph(graph, *yes, *review, terraformArgs)
+		return
+	}
+
+	component := ComponentArg(positional)
+
+	runner := NewRunner()
+	*yes = AutoApprove(runner, component, *yes)
+	unlock, err := LockComponent(runner, component, "apply")
+	if err != nil {
+		Error(err.Error())
+	}
+
+	err = WithNotifications(runner, component, func() error {
+		return WithHooks(runner, component, func() error {
+			err := EnsureInit(runner, component)
+
+			var policies bool
+			if err == nil {
+				policies, err = UsePoliciesE()
+			}
+
+			if err == nil && *plan != "" {
+				err = ApplySavedPlan(runner, component, *plan, terraformArgs)
+			} else if err == nil && (*review || *yes == false || policies) {
+				err = ApplyWithReview(runner, component, *yes, terraformArgs)
+			} else if err == nil {
+				tfArgs := []string{"apply"}
+				if *yes {
+					tfArgs = append(tfArgs, "-auto-approve")
+				}
+
+				var varArgs []string
+				varArgs, err = VarArgsE(runner, component, terraformArgs)
+				if err == nil {
+					err = runner.Run(component, append(tfArgs, varArgs...)...)
+				}
+			}
+
+			if err == nil {
+				err = AfterApply(runner, component)
+			}
+
+			return err
+		})
+	})
+
+	unlock()
+	ExitOnError(err)
+}
+
+// CmdApplyAll is run for the "apply-all" command.
+func CmdApplyAll(args []string) {
+	fs := NewFlagSet("apply-all")
+	AddEnvFlag(fs)
+	yes := fs.Bool("yes", false, "Same as terraform's -auto-approve")
+	AddPolicyFlag(fs)
+	AddParallelFlag(fs)
+	AddInitFlag(fs)
+	AddVarFlags(fs)
+	_, terraformArgs := ParseFlagsWithTerraformArgs(fs, args)
+	CheckParallel(*yes)
+
+	wd, components := FindComponents()
+	graph := LoadGraph(wd, components)
+
+	// The pattern of apply always shows the order, apply-all only does it to
+	// check it before running it for real.
+	if dryRun {
+		PrintComponents("These components would be applied, in this order", graph.Order())
+	}
+
+	ApplyGraph(graph, *yes, false, terraformArgs)
+}
+
+// ApplyGraph applies all the components of the graph, always after their
+// dependencies, skipping the ones whose dependencies failed. With --parallel
+// the components that don't depend on each other are applied at the same
+// time. It exits with an error after the summary if any of them did not
+// succeed.
+func ApplyGraph(graph *tf.Graph, yes bool, review bool, terraformArgs []string) {
+	order := graph.Order()
+
+	// The plans have to be saved to check them against the policies, and
+	// to show what is going to be applied when asking for confirmation.
+	review = review || yes == false || UsePolicies()
+
+	results := RunComponents(NewRunner(), "Applying", order, graph.Dependencies, func(runner *tf.Runner, component string) error {
+		return ApplyComponent(runner, component, yes, review, terraformArgs)
+	})
+	for i := range results {
+		results[i].Tests = TestResults(results[i].Component)
+	}
+
+	if PrintSummary(results) == false {
+		os.Exit(1)
+	}
+}
+
+// ErrApplyCancelled is returned by ApplyWithReview when the user doesn't
+// confirm the plan, so that a multi-component apply skips the component and
+// goes on with the others.
+var ErrApplyCancelled = fmt.Errorf("Apply %w", tf.ErrCancelled)
+
+// ApplyComponent locks and applies the component like the apply command,
+// with its hooks and notifications, and runs what has to be done after the
+// apply. With review the plan is saved and checked before applying it.
+func ApplyComponent(runner *tf.Runner, component string, yes bool, review bool, terraformArgs []string) error {
+	yes = AutoApprove(runner, component, yes)
+
+	tfArgs := []string{"apply"}
+	if yes {
+		tfArgs = append(tfArgs, "-auto-approve")
+	}
+
+	unlock, err := LockComponent(runner, component, "apply")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return WithNotifications(runner, component, func() error {
+		return WithHooks(runner, component, func() error {
+			err := EnsureInit(runner, component)
+			if err == nil && review {
+				err = ApplyWithReview(runner, component, yes, terraformArgs)
+			} else if err == nil {
+				var varArgs []string
+				varArgs, err = VarArgsE(runner, component, terraformArgs)
+				if err == nil {
+					err = runner.Run(component, append(tfArgs, varArgs...)...)
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			return AfterApply(runner, component)
+		})
+	})
+}
+
+// AutoApprove returns true if the component is applied without asking for
+// confirmation: when --yes was passed, or when it has auto_approve in
+// tf.yaml, which is reported since terraform is not going to ask.
+func AutoApprove(runner *tf.Runner, component string, yes bool) bool {
+	if yes || runner.Components[component].AutoApprove == false {
+		return yes
+	}
+
+	fmt.Fprintf(runner.Stderr, "Applying '%s' without confirmation, it has auto_approve in %s.\n", component, tf.ConfigFile)
+	return true
+}
+
+// AfterApply runs what has to be done after the component is successfully
+// applied: running its after_apply hook, publishing its outputs, and running
+// its health checks and smoke tests. It returns an error if any of them
+// fails.
+func AfterApply(runner *tf.Runner, component string) error {
+	metadata, err := tf.GetMetadata(component)
+	if err != nil {
+		return err
+	}
+
+	if err := runner.RunHook(component, tf.HookAfterApply); err != nil {
+		return err
+	}
+
+	if err := PublishOutputs(runner, component, metadata); err != nil {
+		return err
+	}
+	if err := CheckHealth(runner, component, metadata); err != nil {
+		return err
+	}
+
+	return RunTests(runner, component, metadata)
+}
+
+// CheckHealth runs the health checks of the component, returning an error
+// that reports the component as degraded if any of them fails.
+func CheckHealth(runner *tf.Runner, component string, metadata tf.Metadata) error {
+	results := runner.RunHealthChecks(component, metadata.HealthChecks)
+	if len(results) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(runner.Stdout, "\nHealth checks of '%s':\n", component)
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(runner.Stdout, "  FAIL  %s (%d attempts, %s): %s\n", result.Check, result.Attempts, result.Duration.Round(time.Millisecond), result.Err)
+		} else {
+			fmt.Fprintf(runner.Stdout, "  OK    %s (%s)\n", result.Check, result.Duration.Round(time.Millisecond))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("The apply of '%s' succeeded, but %d of %d health checks failed: the component is degraded", component, failed, len(results))
+	}
+
+	return nil
+}
+
+// PublishOutputs publishes the outputs of the component where its
+// component.yaml says, if anywhere.
+func PublishOutputs(runner *tf.Runner, component string, metadata tf.Metadata) error {
+	err := runner.PublishOutputs(component, metadata.Publish)
+	if err != nil {
+		return fmt.Errorf("Could not publish the outputs of '%s': %s", component, err)
+	}
+
+	return nil
+}
+
+// ApplyWithReview saves a plan of the component, checks it against the
+// policies, shows its summary and, once the user confirms it (unless yes is
+// true), applies exactly that plan. It returns ErrApplyCancelled if the user
+// doesn't confirm it. The terraformArgs are passed to the plan,
+// since the apply of a saved plan doesn't accept planning options.
+func ApplyWithReview(runner *tf.Runner, component string, yes bool, terraformArgs []string) error {
+	varArgs, err := VarArgsE(runner, component, terraformArgs)
+	if err != nil {
+		return err
+	}
+
+	planFile, err := runner.SavePlan(component, varArgs...)
+	if err != nil {
+		return fmt.Errorf("The plan of '%s' failed: %w", component, err)
+	}
+	defer os.Remove(planFile)
+
+	summary, err := runner.ShowPlan(component, planFile)
+	if err != nil {
+		return fmt.Errorf("Could not read the plan of '%s': %s", component, err)
+	}
+
+	if err := CheckPolicies(runner, component, planFile); err != nil {
+		return err
+	}
+
+	if runner.DryRun == false {
+		if summary.HasChanges() == false {
+			fmt.Fprintf(runner.Stdout, "\nNo changes to apply in '%s'.\n", component)
+			return nil
+		}
+
+		fmt.Fprintln(runner.Stdout)
+		if yes == false {
+			if err := PrintApplyContext(runner, component); err != nil {
+				return err
+			}
+		}
+		PrintPlanSummary(runner.Stdout, component, summary)
+		fmt.Fprintln(runner.Stdout)
+
+		if yes == false && confirm(fmt.Sprintf("Do you want to apply this plan to '%s'?", component)) == false {
+			return ErrApplyCancelled
+		}
+	}
+
+	return runner.Run(component, "apply", planFile)
+}
+
+// PrintApplyContext prints where the component is going to be applied, so
+// that it can be checked before confirming the apply: its folder, its
+// workspace, its backend and the cloud accounts of its providers.
+func PrintApplyContext(runner *tf.Runner, component string) error {
+	path, err := filepath.Abs(component)
+	if err != nil {
+		path = component
+	}
+
+	backend, err := tf.GetBackend(component)
+	if err != nil {
+		return fmt.Errorf("Could not read the backend of '%s': %w", component, err)
+	}
+
+	writer := tabwriter.NewWriter(runner.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(writer, "Component:\t%s (%s)\n", component, path)
+	fmt.Fprintf(writer, "Workspace:\t%s\n", CurrentWorkspace(runner, component))
+	fmt.Fprintf(writer, "Backend:\t%s\n", backend)
+	for _, account := range runner.CloudAccounts(component) {
+		fmt.Fprintf(writer, "Account:\t%s\n", account)
+	}
+	writer.Flush()
+	fmt.Fprintln(runner.Stdout)
+
+	return nil
+}
+
+// CurrentWorkspace returns the workspace terraform is going to use in the
+// component: the one of --env, the one of TF_WORKSPACE, or the one selected
+// with "terraform workspace select".
+func CurrentWorkspace(runner *tf.Runner, component string) string {
+	if runner.Workspace != "" {
+		return runner.Workspace
+	}
+	if workspace := os.Getenv("TF_WORKSPACE"); workspace != "" {
+		return workspace
+	}
+
+	selected, err := ioutil.ReadFile(filepath.Join(component, ".terraform", "environment"))
+	if err == nil && strings.TrimSpace(string(selected)) != "" {
+		return strings.TrimSpace(string(selected))
+	}
+
+	return tf.DefaultWorkspace
+}
+
+// ApplySavedPlan applies the plan of the component saved with "plan --out",
+// where name is its file, its name or "latest". terraform doesn't ask for
+// confirmation before applying a saved plan.
+func ApplySavedPlan(runner *tf.Runner, component string, name string, terraformArgs []string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("could not find the current working directory: %w", err)
+	}
+
+	planFile, err := tf.FindPlan(wd, component, name)
+	if err != nil {
+		return fmt.Errorf("Could not find the plan of '%s': %w", component, err)
+	}
+
+	if err := CheckPolicies(runner, component, planFile); err != nil {
+		return err
+	}
+
+	return runner.Run(component, append(append([]string{"apply"}, terraformArgs...), planFile)...)
+}
+
+// testResults are the results of the last smoke tests of every component
+// applied by tf, for the summary and the notifications.
+var testResults = struct {
+	results map[string][]tf.TestResult
+	sync.Mutex
+}{results: map[string][]tf.TestResult{}}
+
+// TestResults returns the results of the last smoke tests of the component,
+// or nil if they were not run.
+func TestResults(component string) []tf.TestResult {
+	testResults.Lock()
+	defer testResults.Unlock()
+
+	return testResults.results[component]
+}
+
+// RunTests runs the smoke tests of the component, returning an error with
+// the ones that failed if any of them fails.
+func RunTests(runner *tf.Runner, component string, metadata tf.Metadata) error {
+	results := runner.RunTests(component, metadata.Tests)
+	if len(results) == 0 {
+		return nil
+	}
+
+	testResults.Lock()
+	testResults.results[component] = results
+	testResults.Unlock()
+
+	fmt.Fprintf(runner.Stdout, "\nSmoke tests of '%s':\n", component)
+
+	failed := []string{}
+	for _, result := range results {
+		if result.Passed {
+			fmt.Fprintf(runner.Stdout, "  PASS  %s (%s)\n", result.Name, result.Duration.Round(time.Millisecond))
+		} else {
+			failed = append(failed, result.Name)
+			fmt.Fprintf(runner.Stdout, "  FAIL  %s (%s)\n", result.Name, result.Duration.Round(time.Millisecond))
+			for _, line := range strings.Split(strings.TrimSpace(result.Output), "\n") {
+				fmt.Fprintf(runner.Stdout, "        %s\n", line)
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("The apply of '%s' succeeded, but %d of %d smoke tests failed: %s", component, len(failed), len(results), strings.Join(failed, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// PrintHeader prints the header that separates the output of the components
+// of a multi-component run.
+func PrintHeader(action string, component string, i int, total int) {
+	fmt.Printf("\n==> %s '%s' (%d/%d)\n\n", action, component, i, total)
+}
+
+// RunComponents calls run for every component of a multi-component run,
+// skipping the ones whose blockers did not succeed. With --parallel it runs
+// up to that many components at the same time, each with a copy of the
+// runner whose output is prefixed with the name of the component.
+func RunComponents(runner *tf.Runner, action string, order []string, blockers func(component string) []string, run func(runner *tf.Runner, component string) error) []tf.RunResult {
+	if parallel <= 1 {
+		i := 0
+
+		return tf.RunInOrder(order, blockers, func(component string) error {
+			i++
+			PrintHeader(action, component, i, len(order))
+
+			return run(runner, component)
+		})
+	}
+
+	var mu sync.Mutex
+
+	return tf.RunParallel(order, blockers, parallel, func(component string) error {
+		output := tf.NewPrefixWriter(os.Stdout, "["+component+"] ", &mu)
+		defer output.Flush()
+
+		// The components can't ask for input at the same time.
+		componentRunner := *runner
+		componentRunner.Stdin = nil
+		componentRunner.Stdout = output
+		componentRunner.Stderr = output
+
+		fmt.Fprintf(output, "==> %s '%s'\n", action, component)
+
+		return run(&componentRunner, component)
+	})
+}
+
+// CheckParallel reports an error to the user if --parallel is used by a
+// command that would ask for confirmation, since the components can't ask
+// for it at the same time.
+func CheckParallel(yes bool) {
+	if parallel > 1 && yes == false {
+		Error("--parallel needs -yes, since the components can't ask for confirmation at the same time")
+	}
+}
+
+// PrintSummary prints the result of every component of a multi-component run
+// and returns true if all of them succeeded.
+func PrintSummary(results []tf.RunResult) bool {
+	if dryRun {
+		fmt.Printf("\nSummary (dry run, nothing was run):\n")
+	} else {
+		fmt.Printf("\nSummary:\n")
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+	ok := true
+	for _, result := range results {
+		reason := ""
+		if result.Err != nil {
+			reason = result.Err.Error()
+		}
+		if result.Result != tf.ResultOK {
+			ok = false
+		}
+
+		duration := result.Duration.Round(time.Second).String()
+		if result.Result == tf.ResultSkipped {
+			duration = "-"
+		}
+
+		changes := ""
+		if result.Changes != nil {
+			changes = fmt.Sprintf("+%d ~%d -%d", len(result.Changes.Add), len(result.Changes.Change), len(result.Changes.Destroy))
+		}
+
+		tests := ""
+		if len(result.Tests) > 0 {
+			tests = fmt.Sprintf("tests %d/%d", tf.CountPassed(result.Tests), len(result.Tests))
+		}
+
+		fmt.Fprintf(writer, "  %s\t%s\t%s\t%s\t%s\t%s\n", result.Component, result.Result, duration, changes, tests, reason)
+	}
+	writer.Flush()
+
+	return ok
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// The escape sequences of the colors of the status.
+const (
+	colorGreen   = "\x1b[32m"
+	colorRed     = "\x1b[31m"
+	colorDefault = "\x1b[39m"
+	colorReset   = "\x1b[0m"
+)
+
+// UseColor returns true if the output can be colored: when the standard
+// output is a terminal, unless NO_COLOR is set (see https://no-color.org).
+func UseColor() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	return isTerminal(os.Stdout)
+}
+
+// isTerminal returns true if the file is a terminal.
+func isTerminal(file *os.File) bool {
+	stat, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// ColorStatus returns the status in green if the component is applied, and
+// in red if it is destroyed. The other statuses get an escape sequence of the
+// same length, since the table counts the escape sequences in the width of
+// the cells.
+func ColorStatus(status string) string {
+	color := colorDefault
+	switch status {
+	case tf.StatusApplied:
+		color = colorGreen
+	case tf.StatusDestroyed:
+		color = colorRed
+	}
+
+	return color + status + colorReset
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// FormatGitHubComment renders the plans as Markdown for a pull request
+// comment, like Atlantis does.
+const FormatGitHubComment = "github-comment"
+
+// PlanFormats are the formats accepted by the --format flag of plan and
+// plan-all.
+var PlanFormats = []string{FormatGitHubComment}
+
+// CommentOutput makes everything that would be printed to the standard
+// output go to the standard error instead, so that only the comment is
+// printed to the standard output, which is returned.
+func CommentOutput() *os.File {
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+
+	return stdout
+}
+
+// WriteGitHubComment writes the plans of the components as Markdown for a
+// pull request comment: a title, and a section for every component whose
+// resources are in a collapsible block.
+func WriteGitHubComment(w io.Writer, results []tf.RunResult) {
+	changed := 0
+	failed := 0
+	for _, result := range results {
+		if result.Result != tf.ResultOK {
+			failed++
+		} else if result.Changes != nil && result.Changes.HasChanges() {
+			changed++
+		}
+	}
+
+	if len(results) > 1 {
+		fmt.Fprintf(w, "### Plan of %d components: %d with changes", len(results), changed)
+		if failed > 0 {
+			fmt.Fprintf(w, ", %d failed", failed)
+		}
+		fmt.Fprintf(w, "\n\n")
+	}
+
+	for _, result := range results {
+		writeCommentSection(w, result)
+	}
+}
+
+func writeCommentSection(w io.Writer, result tf.RunResult) {
+	if result.Result != tf.ResultOK {
+		fmt.Fprintf(w, "#### :x: `%s` %s\n\n", result.Component, result.Result)
+		if result.Err != nil {
+			fmt.Fprintf(w, "```\n%s\n```\n\n", strings.TrimSpace(result.Err.Error()))
+		}
+		return
+	}
+
+	if result.Changes == nil || result.Changes.HasChanges() == false {
+		fmt.Fprintf(w, "#### :white_check_mark: `%s`: no changes\n\n", result.Component)
+		return
+	}
+
+	summary := result.Changes
+	fmt.Fprintf(w, "#### :memo: `%s`: %s\n\n", result.Component, summary)
+	fmt.Fprintf(w, "<details><summary>Show the resources</summary>\n\n")
+
+	// In the diff blocks of GitHub, + is green, - is red and ! is orange.
+	fmt.Fprintf(w, "```diff\n")
+	for _, address := range summary.Add {
+		fmt.Fprintf(w, "+ %s\n", address)
+	}
+	for _, address := range summary.Change {
+		fmt.Fprintf(w, "! %s\n", address)
+	}
+	for _, address := range summary.Destroy {
+		fmt.Fprintf(w, "- %s\n", address)
+	}
+	fmt.Fprintf(w, "```\n\n</details>\n\n")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// CompletionCommands are the commands completed by the shell.
+var CompletionCommands = []string{
+	"status", "output", "init", "plan", "plan-all", "apply", "apply-all",
+	"destroy", "destroy-all", "drift", "cost", "validate", "import", "taint", "untaint", "state", "lint", "fmt", "history", "graph", "describe", "unlock", "ui", "serve", "daemon", "doctor",
+	"completion",
+}
+
+// ComponentCommands are the commands whose argument is a component, so the
+// shell completes it with the names of the components.
+var ComponentCommands = []string{"output", "init", "plan", "apply", "destroy", "drift", "cost", "validate", "lint", "import", "taint", "untaint", "state", "history", "describe", "unlock"}
+
+// CompletionShells are the shells supported by "tf completion".
+var CompletionShells = []string{"bash", "zsh", "fish"}
+
+const bashCompletion = `# bash completion for tf, load it with: source <(tf completion bash)
+_tf() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=($(compgen -W "%[1]s" -- "$cur"))
+        return
+    fi
+
+    case "${COMP_WORDS[1]}" in
+        %[2]s)
+            COMPREPLY=($(compgen -W "$(tf completion components 2>/dev/null)" -- "$cur"))
+            ;;
+        completion)
+            COMPREPLY=($(compgen -W "%[3]s" -- "$cur"))
+            ;;
+    esac
+}
+complete -o default -F _tf tf
+`
+
+const zshCompletion = `#compdef tf
+# zsh completion for tf, load it with: source <(tf completion zsh)
+_tf() {
+    if (( CURRENT == 2 )); then
+        compadd -- %[1]s
+        return
+    fi
+
+    case "$words[2]" in
+        %[2]s)
+            compadd -- ${(f)"$(tf completion components 2>/dev/null)"}
+            ;;
+        completion)
+            compadd -- %[3]s
+            ;;
+    esac
+}
+compdef _tf tf
+`
+
+const fishCompletion = `# fish completion for tf, load it with: tf completion fish | source
+complete -c tf -f
+complete -c tf -n "__fish_use_subcommand" -a "%[1]s"
+complete -c tf -n "__fish_seen_subcommand_from %[2]s" -a "(tf completion components 2>/dev/null)"
+complete -c tf -n "__fish_seen_subcommand_from completion" -a "%[3]s"
+`
+
+// CmdCompletion is run for the "completion" command.
+func CmdCompletion(args []string) {
+	fs := NewFlagSet("completion")
+	positional := ParseFlags(fs, args)
+
+	if len(positional) < 1 {
+		PrintUsage()
+		os.Exit(1)
+	}
+
+	// The completion scripts run "tf completion components" to get the names
+	// of the components. Nothing but the names is printed, not even the
+	// errors, since everything would become a completion.
+	if positional[0] == "components" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return
+		}
+
+		components, _ := tf.FindProjectComponents(wd)
+		for _, component := range components {
+			fmt.Println(component)
+		}
+		return
+	}
+
+	commands := strings.Join(CompletionCommands, " ")
+	shells := strings.Join(CompletionShells, " ")
+
+	switch positional[0] {
+	case "bash":
+		fmt.Printf(bashCompletion, commands, strings.Join(ComponentCommands, "|"), shells)
+	case "zsh":
+		fmt.Printf(zshCompletion, commands, strings.Join(ComponentCommands, "|"), shells)
+	case "fish":
+		fmt.Printf(fishCompletion, commands, strings.Join(ComponentCommands, " "), shells)
+	default:
+		Error(fmt.Sprintf("Unknown shell '%s', it should be one of: %s", positional[0], strings.Join(CompletionShells, ", ")))
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// CmdCost is run for the "cost" command.
+func CmdCost(args []string) {
+	fs := NewFlagSet("cost")
+	all := fs.Bool("all", false, "Estimate the cost of all the components")
+	AddEnvFlag(fs)
+	AddParallelFlag(fs)
+	AddInitFlag(fs)
+	AddVarFlags(fs)
+	positional, terraformArgs := ParseFlagsWithTerraformArgs(fs, args)
+
+	if _, err := exec.LookPath(tf.InfracostBinary); err != nil {
+		Error("infracost was not found in the PATH, install it from https://www.infracost.io/docs/")
+	}
+
+	var order []string
+	if *all {
+		wd, components := FindComponents()
+		order = LoadGraph(wd, components).Order()
+	} else if len(positional) > 0 && tf.IsPattern(positional[0]) {
+		order = PatternGraph(positional[0]).Order()
+	} else {
+		order = []string{ComponentArg(positional)}
+	}
+
+	runner := NewRunner()
+	costs := map[string]tf.Cost{}
+	var mu sync.Mutex
+
+	noBlockers := func(string) []string { return nil }
+
+	results := RunComponents(runner, "Estimating the cost of", order, noBlockers, func(runner *tf.Runner, component string) error {
+		return WithHooks(runner, component, func() error {
+			if err := EnsureInit(runner, component); err != nil {
+				return err
+			}
+
+			varArgs, err := VarArgsE(runner, component, terraformArgs)
+			if err != nil {
+				return err
+			}
+
+			planFile, err := runner.SavePlan(component, varArgs...)
+			if err != nil {
+				return err
+			}
+			defer os.Remove(planFile)
+
+			cost, err := runner.EstimateCost(component, planFile)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			costs[component] = cost
+			mu.Unlock()
+
+			return nil
+		})
+	})
+
+	ok := PrintSummary(results)
+
+	if runner.DryRun == false && len(costs) > 0 {
+		PrintCosts(results, costs)
+	}
+
+	if ok == false {
+		os.Exit(1)
+	}
+}
+
+// PrintCosts prints the monthly cost of every component before and after its
+// plan, and the total of all of them.
+func PrintCosts(results []tf.RunResult, costs map[string]tf.Cost) {
+	fmt.Printf("\nMonthly cost:\n")
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+	total := tf.Cost{}
+	for _, result := range results {
+		cost, ok := costs[result.Component]
+		if ok == false {
+			continue
+		}
+
+		total.Past += cost.Past
+		total.Total += cost.Total
+		if total.Currency == "" {
+			total.Currency = cost.Currency
+		}
+
+		fmt.Fprintf(writer, "  %s\t%.2f\t->\t%.2f\t(%+.2f)\t%s\n", result.Component, cost.Past, cost.Total, cost.Diff(), cost.Currency)
+	}
+	fmt.Fprintf(writer, "  total\t%.2f\t->\t%.2f\t(%+.2f)\t%s\n", total.Past, total.Total, total.Diff(), total.Currency)
+	writer.Flush()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// CmdDaemon is run for the "daemon" command.
+func CmdDaemon(args []string) {
+	fs := NewFlagSet("daemon")
+	interval := fs.Duration("interval", 6*time.Hour, "How often the drift of the components is checked")
+	listen := fs.String("listen", "", "Also serve the HTTP API of tf serve with the metrics on this address, like :8080")
+	token := fs.String("token", os.Getenv(TokenEnv), "Token the clients of --listen have to send as 'Authorization: Bearer <token>' (default: $"+TokenEnv+")")
+	AddParallelFlag(fs)
+	ParseFlags(fs, args)
+
+	if *interval <= 0 {
+		Error("--interval has to be positive")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		InternalError("Could not find the current working directory", err)
+	}
+
+	server := &Server{wd: wd, token: *token, metrics: NewMetrics()}
+
+	if *listen != "" {
+		if *token == "" {
+			fmt.Fprintf(os.Stderr, "Warning: there is no --token, anybody who can reach %s can apply the components\n", *listen)
+		}
+
+		fmt.Printf("Listening on %s\n", *listen)
+		go func() {
+			if err := http.ListenAndServe(*listen, server); err != nil {
+				Error(fmt.Sprintf("Could not listen on %s: %s", *listen, err))
+			}
+		}()
+	}
+
+	drifted := map[string]bool{}
+	for {
+		drifted = server.CheckDrifts(drifted)
+		time.Sleep(*interval)
+	}
+}
+
+// CheckDrifts checks the drift of all the components, running up to
+// --parallel checks at the same time, and prints which ones have drifted.
+// The components that drifted since the previous check (the ones that are not
+// in previous) are notified to the webhooks of tf.yaml. It returns the
+// components that have drifted, for the next check. The components that
+// could not be checked are only counted, so that the daemon keeps running.
+func (s *Server) CheckDrifts(previous map[string]bool) map[string]bool {
+	start := time.Now()
+
+	components, config, err := s.components()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s Could not find the components: %s\n", start.Format(time.RFC3339), err)
+		return previous
+	}
+
+	drifted := map[string]bool{}
+	failed := 0
+	var mu sync.Mutex
+
+	tf.ParallelEach(components, parallel, func(i int, component string) {
+		// The output of terraform is only shown when the check fails.
+		var output bytes.Buffer
+		var drift bool
+		runner, err := NewRunnerE()
+		if err == nil {
+			runner.Stdin = nil
+			runner.Stdout = &output
+			runner.Stderr = &output
+
+			drift, err = CheckDrift(runner, component, []string{"-no-color"})
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "Could not check the drift of '%s': %s\n%s", component, err, output.String())
+			return
+		}
+
+		s.metrics.RecordDrift(component, drift)
+		if drift {
+			drifted[component] = true
+		}
+		if drift && previous[component] == false && config.Notifications.Enabled() {
+			runner.Stdout = os.Stdout
+			runner.Stderr = os.Stderr
+			runner.Notify(config.Notifications, tf.NewNotification(tf.NotifyDrift, component))
+		}
+	})
+
+	names := []string{}
+	for _, component := range components {
+		if drifted[component] {
+			names = append(names, component)
+		}
+	}
+
+	fmt.Printf("%s %d of %d components have drifted", start.Format(time.RFC3339), len(names), len(components)-failed)
+	if len(names) > 0 {
+		fmt.Printf(": %s", strings.Join(names, ", "))
+	}
+	if failed > 0 {
+		fmt.Printf(" (%d could not be checked)", failed)
+	}
+	fmt.Printf(" in %s.\n", time.Since(start).Round(time.Second))
+
+	return drifted
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// CmdDescribe is run for the "describe" command.
+func CmdDescribe(args []string) {
+	fs := NewFlagSet("describe")
+	component := ComponentArg(ParseFlags(fs, args))
+
+	path, err := filepath.Abs(component)
+	if err != nil {
+		InternalError("Could not find the path of the component", err)
+	}
+	wd, components := FindComponents()
+	config := LoadConfig(wd).Components[component]
+	runner := NewRunner()
+
+	// The components with environments have a status for each of them.
+	status := ""
+	for _, workspace := range config.Workspaces() {
+		workspaceStatus, err := runner.GetWorkspaceStatus(component, workspace)
+		if err != nil {
+			InternalError("GetStatus failed", err)
+		}
+
+		if len(config.Environments) == 0 {
+			status = workspaceStatus
+		} else {
+			status = strings.TrimPrefix(status+", "+workspace+" "+workspaceStatus, ", ")
+		}
+	}
+	backend, err := tf.GetBackend(component)
+	if err != nil {
+		InternalError("GetBackend failed", err)
+	}
+	version, err := versionColumn(runner, component)
+	if err != nil {
+		InternalError("RequiredVersion failed", err)
+	}
+	providers, err := providersColumn(runner, component)
+	if err != nil {
+		InternalError("GetProviders failed", err)
+	}
+	variables, err := tf.GetVariables(component)
+	if err != nil {
+		InternalError("GetVariables failed", err)
+	}
+	outputs, err := tf.GetOutputs(component)
+	if err != nil {
+		InternalError("GetOutputs failed", err)
+	}
+	metadata, err := tf.GetMetadata(component)
+	if err != nil {
+		Error(err.Error())
+	}
+	graph := LoadGraph(wd, components)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(writer, "Component:\t%s\n", component)
+	fmt.Fprintf(writer, "Description:\t%s\n", orNone(metadata.Description))
+	fmt.Fprintf(writer, "Owner:\t%s\n", orNone(metadata.Owner))
+	fmt.Fprintf(writer, "Tier:\t%s\n", orNone(metadata.Tier))
+	fmt.Fprintf(writer, "Labels:\t%s\n", orNone(metadata.LabelsString()))
+	fmt.Fprintf(writer, "Path:\t%s\n", path)
+	fmt.Fprintf(writer, "Status:\t%s\n", status)
+	fmt.Fprintf(writer, "Backend:\t%s\n", backend)
+	fmt.Fprintf(writer, "Terraform:\t%s\n", orNone(version))
+	fmt.Fprintf(writer, "Providers:\t%s\n", orNone(providers))
+	fmt.Fprintf(writer, "Depends on:\t%s\n", orNone(strings.Join(graph.Dependencies(component), ", ")))
+	fmt.Fprintf(writer, "Needed by:\t%s\n", orNone(strings.Join(graph.Dependents(component), ", ")))
+	writer.Flush()
+
+	fmt.Printf("\nVariables:\n")
+	if len(variables) == 0 {
+		fmt.Printf("  (none)\n")
+	}
+	for _, variable := range variables {
+		value := "(required)"
+		if variable.Default != "" {
+			value = "= " + oneLine(variable.Default)
+		}
+		if variable.Sensitive {
+			value += " (sensitive)"
+		}
+
+		fmt.Fprintf(writer, "  %s\t%s\t%s\t%s\n", variable.Name, orNone(oneLine(variable.Type)), value, variable.Description)
+	}
+	writer.Flush()
+
+	fmt.Printf("\nOutputs:\n")
+	if len(outputs) == 0 {
+		fmt.Printf("  (none)\n")
+	}
+	for _, output := range outputs {
+		sensitive := ""
+		if output.Sensitive {
+			sensitive = "(sensitive)"
+		}
+
+		fmt.Fprintf(writer, "  %s\t%s\t%s\n", output.Name, sensitive, output.Description)
+	}
+	writer.Flush()
+}
+
+// orNone returns "-" for empty values, so that they are visible in the
+// description.
+func orNone(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+// oneLine joins the lines of a multi-line expression.
+func oneLine(expression string) string {
+	return strings.Join(strings.Fields(expression), " ")
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// CmdDestroy is run for the "destroy" command.
+func CmdDestroy(args []string) {
+	fs := NewFlagSet("destroy")
+	AddEnvFlag(fs)
+	yes := fs.Bool("yes", false, "Same as terraform's -auto-approve")
+	AddParallelFlag(fs)
+	AddVarFlags(fs)
+	positional, terraformArgs := ParseFlagsWithTerraformArgs(fs, args)
+
+	if len(positional) > 0 && tf.IsPattern(positional[0]) {
+		CheckParallel(*yes)
+		DestroyGraph(PatternGraph(positional[0]), *yes, terraformArgs)
+		return
+	}
+
+	component := ComponentArg(positional)
+
+	tfArgs := []string{"destroy"}
+	if *yes {
+		tfArgs = append(tfArgs, "-auto-approve")
+	}
+
+	runner := NewRunner()
+	unlock, err := LockComponent(runner, component, "destroy")
+	if err != nil {
+		Error(err.Error())
+	}
+
+	err = WithHooks(runner, component, func() error {
+		varArgs, err := VarArgsE(runner, component, terraformArgs)
+		if err != nil {
+			return err
+		}
+
+		return runner.Run(component, append(tfArgs, varArgs...)...)
+	})
+	unlock()
+	ExitOnError(err)
+}
+
+// CmdDestroyAll is run for the "destroy-all" command.
+func CmdDestroyAll(args []string) {
+	fs := NewFlagSet("destroy-all")
+	AddEnvFlag(fs)
+	yes := fs.Bool("yes", false, "Same as terraform's -auto-approve, and don't ask for confirmation")
+	AddParallelFlag(fs)
+	AddVarFlags(fs)
+	_, terraformArgs := ParseFlagsWithTerraformArgs(fs, args)
+	CheckParallel(*yes)
+
+	wd, components := FindComponents()
+	DestroyGraph(LoadGraph(wd, components), *yes, terraformArgs)
+}
+
+// DestroyGraph lists the components of the graph and, once confirmed (unless
+// yes is true), destroys them always before the components they depend on,
+// and with --parallel at the same time as the ones that are independent. It
+// exits with an error after the summary if any of them did not succeed.
+func DestroyGraph(graph *tf.Graph, yes bool, terraformArgs []string) {
+	order := graph.ReverseOrder()
+
+	runner := NewRunner()
+
+	workspace := tf.DefaultWorkspace
+	if runner.Workspace != "" {
+		workspace = runner.Workspace
+	}
+
+	fmt.Printf("These components will be destroyed, in this order:\n")
+	for _, component := range order {
+		status, err := runner.GetWorkspaceStatus(component, workspace)
+		if err != nil {
+			InternalError("GetStatus failed", err)
+		}
+
+		fmt.Printf("  - %s (%s)\n", component, status)
+	}
+	fmt.Println()
+
+	if yes == false && runner.DryRun == false && Confirm("Do you really want to destroy all of them?") == false {
+		Error("Destroy cancelled")
+	}
+
+	tfArgs := []string{"destroy"}
+	if yes {
+		tfArgs = append(tfArgs, "-auto-approve")
+	}
+
+	results := RunComponents(runner, "Destroying", order, graph.Dependents, func(runner *tf.Runner, component string) error {
+		unlock, err := LockComponent(runner, component, "destroy")
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		return WithHooks(runner, component, func() error {
+			varArgs, err := VarArgsE(runner, component, terraformArgs)
+			if err != nil {
+				return err
+			}
+
+			return runner.Run(component, append(tfArgs, varArgs...)...)
+		})
+	})
+
+	if PrintSummary(results) == false {
+		os.Exit(1)
+	}
+}
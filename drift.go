@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// CmdDrift is run for the "drift" command.
+func CmdDrift(args []string) {
+	fs := NewFlagSet("drift")
+	all := fs.Bool("all", false, "Check all the components")
+	AddEnvFlag(fs)
+	AddParallelFlag(fs)
+	AddInitFlag(fs)
+	AddVarFlags(fs)
+	positional, terraformArgs := ParseFlagsWithTerraformArgs(fs, args)
+
+	var order []string
+	if *all {
+		wd, components := FindComponents()
+		order = LoadGraph(wd, components).Order()
+	} else if len(positional) > 0 && tf.IsPattern(positional[0]) {
+		order = PatternGraph(positional[0]).Order()
+	} else {
+		order = []string{ComponentArg(positional)}
+	}
+
+	runner := NewRunner()
+	hasDrift := map[string]bool{}
+	var mu sync.Mutex
+
+	noBlockers := func(string) []string { return nil }
+
+	results := RunComponents(runner, "Checking the drift of", order, noBlockers, func(runner *tf.Runner, component string) error {
+		drift, err := CheckDrift(runner, component, terraformArgs)
+		if drift {
+			mu.Lock()
+			hasDrift[component] = true
+			mu.Unlock()
+		}
+
+		return err
+	})
+
+	ok := PrintSummary(results)
+
+	checked := 0
+	drifted := []string{}
+	for _, result := range results {
+		if result.Result == tf.ResultOK {
+			checked++
+		}
+		if hasDrift[result.Component] {
+			drifted = append(drifted, result.Component)
+		}
+	}
+
+	if runner.DryRun == false && checked > 0 {
+		fmt.Printf("\n%d of %d checked components have drifted", len(drifted), checked)
+		if len(drifted) > 0 {
+			fmt.Printf(": %s", strings.Join(drifted, ", "))
+		}
+		fmt.Printf(".\n")
+	}
+
+	// The same exit codes as terraform's -detailed-exitcode, so that a
+	// nightly job can tell a drift from a failure.
+	if ok == false {
+		os.Exit(1)
+	}
+	if len(drifted) > 0 {
+		os.Exit(2)
+	}
+}
+
+// CheckDrift initializes the component if it needs it and runs a
+// refresh-only plan with its hooks, returning true if it has drifted.
+func CheckDrift(runner *tf.Runner, component string, terraformArgs []string) (bool, error) {
+	drift := false
+
+	err := WithHooks(runner, component, func() error {
+		if err := EnsureInit(runner, component); err != nil {
+			return err
+		}
+
+		varArgs, err := VarArgsE(runner, component, terraformArgs)
+		if err != nil {
+			return err
+		}
+
+		drift, err = runner.DetectDrift(component, varArgs...)
+		return err
+	})
+
+	return drift, err
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// These are the flags that are accepted by every command.
+var (
+	dryRun       bool
+	showCommands bool
+	binary       string
+	verbose      bool
+	debug        bool
+	noCache      bool
+	maxFiles     OptionalInt
+	maxDepth     OptionalInt
+	symlinks     bool
+	excludes     StringList
+)
+
+// noInit is the --no-init flag of the commands that initialize the
+// components automatically.
+var noInit bool
+
+// AddInitFlag adds the --no-init flag to the commands that run EnsureInit.
+func AddInitFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&noInit, "no-init", false, "Don't run 'terraform init' when the component is not initialized")
+}
+
+// EnsureInit initializes the component if it needs it, unless --no-init was
+// passed.
+func EnsureInit(runner *tf.Runner, component string) error {
+	if noInit {
+		return nil
+	}
+
+	return runner.EnsureInit(component)
+}
+
+// noPolicy is the --no-policy flag of the commands that apply.
+var noPolicy bool
+
+// AddPolicyFlag adds the --no-policy flag to the commands that apply.
+func AddPolicyFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&noPolicy, "no-policy", false, "Don't check the plans against the policies of the "+tf.PolicyDir+" folder")
+}
+
+// UsePolicies returns true if the plans have to pass the policies before
+// they are applied: when there is a policy folder, unless --no-policy was
+// passed. It reports an error to the user if conftest is missing.
+func UsePolicies() bool {
+	use, err := UsePoliciesE()
+	if err != nil {
+		Error(err.Error())
+	}
+
+	return use
+}
+
+// UsePoliciesE is UsePolicies, but it returns the error instead of exiting,
+// for the commands that can't exit (like the jobs of the server).
+func UsePoliciesE() (bool, error) {
+	if noPolicy {
+		return false, nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return false, fmt.Errorf("could not find the current working directory: %w", err)
+	}
+	if tf.HasPolicies(wd) == false {
+		return false, nil
+	}
+
+	if _, err := exec.LookPath(tf.ConftestBinary); err != nil {
+		return false, fmt.Errorf("There is a %s folder, but %s was not found in the PATH to check the plans. Install it, or pass --no-policy", tf.PolicyDir, tf.ConftestBinary)
+	}
+
+	return true, nil
+}
+
+// CheckPolicies checks the plan saved in planFile against the policies, if
+// UsePoliciesE says so.
+func CheckPolicies(runner *tf.Runner, component string, planFile string) error {
+	use, err := UsePoliciesE()
+	if err != nil || use == false {
+		return err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("could not find the current working directory: %w", err)
+	}
+
+	return runner.CheckPolicies(wd, component, planFile)
+}
+
+// parallel is the --parallel flag of the commands that run on many
+// components.
+var parallel int
+
+// AddParallelFlag adds the --parallel flag, which runs the components that
+// don't depend on each other at the same time.
+func AddParallelFlag(fs *flag.FlagSet) {
+	fs.IntVar(&parallel, "parallel", 1, "Run up to n components that don't depend on each other at the same time, prefixing their output")
+}
+
+// environment is the --env flag of the commands that work on the
+// environments of the components.
+var environment string
+
+// AddEnvFlag adds the --env flag, which selects the environment (and so the
+// terraform workspace) of the components.
+func AddEnvFlag(fs *flag.FlagSet) {
+	fs.StringVar(&environment, "env", "", "Environment of the components, which is the terraform workspace they run in")
+}
+
+// vars and varFiles are the -var and -var-file flags of the commands that
+// plan.
+var (
+	vars     KeyValueList
+	varFiles StringList
+)
+
+// AddVarFlags adds the -var and -var-file flags to the commands that plan.
+func AddVarFlags(fs *flag.FlagSet) {
+	fs.Var(&vars, "var", "Set a variable of the component, as key=value (can be repeated)")
+	fs.Var(&varFiles, "var-file", "Set the variables of the component from a file (can be repeated)")
+}
+
+// VarArgs returns the -var and -var-file arguments of the component followed
+// by args. The defaults of the component in tf.yaml go first, so that the
+// flags win over them.
+func VarArgs(runner *tf.Runner, component string, args []string) []string {
+	varArgs, err := VarArgsE(runner, component, args)
+	if err != nil {
+		Error(err.Error())
+	}
+
+	return varArgs
+}
+
+// VarArgsE is VarArgs, but it returns the error instead of exiting.
+func VarArgsE(runner *tf.Runner, component string, args []string) ([]string, error) {
+	config := runner.Components[component]
+	flagArgs := []string{}
+
+	if environment != "" {
+		if len(config.Environments) > 0 && contains(config.Environments, environment) == false {
+			return nil, fmt.Errorf("The component '%s' has no '%s' environment, it has: %s", component, environment, strings.Join(config.Environments, ", "))
+		}
+
+		// Every environment can have its own variables, next to the
+		// component.
+		envFile := environment + ".tfvars"
+		if _, err := os.Stat(filepath.Join(component, envFile)); err == nil {
+			flagArgs = append(flagArgs, "-var-file", envFile)
+		}
+	}
+
+	for _, v := range vars {
+		flagArgs = append(flagArgs, "-var", v)
+	}
+
+	// terraform runs inside the component, while the files are relative to
+	// where tf is run.
+	for _, file := range varFiles {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return nil, fmt.Errorf("could not find the path of the var file: %w", err)
+		}
+		flagArgs = append(flagArgs, "-var-file", path)
+	}
+
+	// The outputs of the other components are read last, since they are
+	// written to a file that only the command removes.
+	varArgs, err := runner.ComponentVarArgs(component)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append(varArgs, flagArgs...), args...), nil
+}
+
+// NewFlagSet returns the flag set of a command, with the flags that are
+// accepted by every command already defined.
+func NewFlagSet(command string) *flag.FlagSet {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	fs.BoolVar(&dryRun, "dry-run", false, "Print the terraform commands instead of running them")
+	fs.BoolVar(&showCommands, "show-commands", false, "Print the terraform commands before running them")
+	fs.StringVar(&binary, "binary", "", "Binary to run instead of terraform, like tofu (default: $TF_BINARY, the binary of tf.yaml or the one found in the PATH)")
+	fs.BoolVar(&verbose, "v", false, "Log the commands tf runs and how long they take to stderr")
+	fs.BoolVar(&debug, "debug", false, "Log everything tf does to stderr, like the directories it walks")
+	fs.Var(&maxFiles, "max-files", "Number of files walked to find the components before giving up, 0 for no limit (default: the max_files of tf.yaml, or 1000)")
+	fs.Var(&maxDepth, "max-depth", "Levels of directories searched to find the components, 0 for no limit (default: the max_depth of tf.yaml, or 0)")
+	fs.BoolVar(&symlinks, "follow-symlinks", false, "Also search the components in the directories the symbolic links point to (default: the follow_symlinks of tf.yaml)")
+	fs.Var(&excludes, "exclude", "Ignore the components that match this pattern, like the exclude of tf.yaml (can be repeated)")
+	fs.BoolVar(&noCache, "no-cache", false, "Search the components in all the directories instead of using "+tf.CacheFile)
+
+	return fs
+}
+
+// ParseFlags parses the flags of a command, which can appear before or after
+// its positional arguments, and returns the positional arguments. It reports
+// an error to the user if there are terraform arguments after "--", for the
+// commands that don't pass them to terraform.
+func ParseFlags(fs *flag.FlagSet, args []string) []string {
+	positional, terraformArgs := ParseFlagsWithTerraformArgs(fs, args)
+	if len(terraformArgs) > 0 {
+		Error(fmt.Sprintf("The %s command doesn't accept terraform arguments after --", fs.Name()))
+	}
+
+	return positional
+}
+
+// ParseFlagsWithTerraformArgs is like ParseFlags, but it also returns the
+// arguments after "--", which are passed to terraform as they are.
+func ParseFlagsWithTerraformArgs(fs *flag.FlagSet, args []string) ([]string, []string) {
+	terraformArgs := []string{}
+	for i, arg := range args {
+		if arg == "--" {
+			args, terraformArgs = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	positional := []string{}
+
+	for {
+		// With flag.ExitOnError Parse never returns an error.
+		fs.Parse(args)
+
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	tf.CacheComponents = noCache == false
+
+	if debug {
+		tf.LogLevel = tf.LogDebug
+	} else if verbose {
+		tf.LogLevel = tf.LogVerbose
+	}
+
+	return positional, terraformArgs
+}
+
+// IsFlagSet returns true if the flag was passed to the command.
+func IsFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
+
+// SelectedBinary returns the binary that runs the commands: the one of
+// --binary, or else the one of TF_BINARY, or else the one of tf.yaml, or
+// else the one found in the PATH.
+func SelectedBinary(config tf.Config) string {
+	if binary != "" {
+		return binary
+	}
+	if os.Getenv(tf.BinaryEnv) == "" && config.Binary != "" {
+		return config.Binary
+	}
+
+	return tf.DetectBinary()
+}
+
+// NewRunner returns the runner configured with the flags of the command and
+// the component settings of tf.yaml.
+func NewRunner() *tf.Runner {
+	runner, err := NewRunnerE()
+	if err != nil {
+		Error(err.Error())
+	}
+
+	return runner
+}
+
+// NewRunnerE is NewRunner, but it returns the error instead of exiting.
+func NewRunnerE() (*tf.Runner, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("could not find the current working directory: %w", err)
+	}
+
+	config, err := tf.LoadConfig(wd)
+	if err != nil {
+		return nil, err
+	}
+
+	runner := tf.NewRunner()
+	runner.DryRun = dryRun
+	runner.ShowCommands = showCommands
+	runner.Components = config.Components
+	runner.DownloadVersions = config.DownloadTerraform
+	runner.Binary = SelectedBinary(config)
+	runner.Workspace = environment
+	runner.AuditRoot = wd
+	runner.Audit = config.Audit
+	runner.Locks = config.Locks
+
+	return runner, nil
+}
+
+// StringList is a flag that can be passed multiple times, keeping all the
+// values.
+type StringList []string
+
+func (l *StringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *StringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// OptionalInt is an int flag that knows if it was passed.
+type OptionalInt struct {
+	Value int
+	IsSet bool
+}
+
+func (i *OptionalInt) String() string {
+	if i == nil || i.IsSet == false {
+		return ""
+	}
+
+	return strconv.Itoa(i.Value)
+}
+
+func (i *OptionalInt) Set(value string) error {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	if v < 0 {
+		return fmt.Errorf("it can't be negative")
+	}
+
+	i.Value = v
+	i.IsSet = true
+	return nil
+}
+
+// contains returns true if the value is in the list.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// KeyValueList is a StringList whose values must be key=value.
+type KeyValueList []string
+
+func (l *KeyValueList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *KeyValueList) Set(value string) error {
+	if strings.Contains(value, "=") == false {
+		return fmt.Errorf("'%s' should be key=value", value)
+	}
+
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// CmdFmt is run for the "fmt" command.
+func CmdFmt(args []string) {
+	fs := NewFlagSet("fmt")
+	check := fs.Bool("check", false, "Only list the files that are not formatted, and exit with an error if there are any")
+	ParseFlags(fs, args)
+
+	_, components := FindComponents()
+
+	// The local modules are formatted too, once even if many components
+	// use them.
+	dirs := map[string]bool{}
+	for _, component := range components {
+		dirs[component] = true
+
+		modules, err := tf.LocalModules(component)
+		if err != nil {
+			InternalError("Could not read the modules of "+component, err)
+		}
+		for _, module := range modules {
+			if _, err := os.Stat(module); err == nil {
+				dirs[module] = true
+			}
+		}
+	}
+
+	order := []string{}
+	for dir := range dirs {
+		order = append(order, dir)
+	}
+	sort.Strings(order)
+
+	runner := NewRunner()
+	files := []string{}
+	failed := []string{}
+
+	for _, dir := range order {
+		formatted, err := runner.Fmt(dir, *check)
+		if err != nil {
+			failed = append(failed, dir)
+			continue
+		}
+		files = append(files, formatted...)
+	}
+
+	for _, file := range files {
+		fmt.Println(file)
+	}
+
+	if len(failed) > 0 {
+		Error(fmt.Sprintf("terraform fmt failed in: %s", strings.Join(failed, ", ")))
+	}
+	if *check && len(files) > 0 {
+		Error(fmt.Sprintf("%d files are not formatted, run: tf fmt", len(files)))
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// These are the formats accepted by the --format flag.
+const (
+	FormatTable    = "table"
+	FormatMarkdown = "markdown"
+	FormatCSV      = "csv"
+	FormatYAML     = "yaml"
+	FormatJSON     = "json"
+)
+
+// Formats are all the formats accepted by the --format flag.
+var Formats = []string{FormatTable, FormatMarkdown, FormatCSV, FormatYAML, FormatJSON}
+
+// CheckFormat reports an error to the user if the format is not one of the
+// supported formats.
+func CheckFormat(format string, supported []string) {
+	for _, f := range supported {
+		if f == format {
+			return
+		}
+	}
+
+	Error(fmt.Sprintf("Unknown format '%s', it should be one of: %s", format, strings.Join(supported, ", ")))
+}
+
+// WriteRows writes the rows in the given format. The header contains the
+// names of the columns, and it is not printed in the table format to keep it
+// easy to read.
+func WriteRows(w io.Writer, format string, header []string, rows [][]string) error {
+	switch format {
+	case FormatMarkdown:
+		return writeMarkdown(w, header, rows)
+	case FormatCSV:
+		return writeCSV(w, header, rows)
+	case FormatYAML:
+		return writeYAML(w, header, rows)
+	case FormatJSON:
+		return writeJSON(w, header, rows)
+	default:
+		return writeTable(w, rows)
+	}
+}
+
+func writeTable(w io.Writer, rows [][]string) error {
+	writer := tabwriter.NewWriter(w, 0, 8, 1, '\t', 0)
+
+	for _, row := range rows {
+		fmt.Fprintf(writer, "%s\n", strings.Join(row, "\t"))
+	}
+
+	return writer.Flush()
+}
+
+func writeMarkdown(w io.Writer, header []string, rows [][]string) error {
+	separator := []string{}
+	for range header {
+		separator = append(separator, "---")
+	}
+
+	lines := [][]string{header, separator}
+	lines = append(lines, rows...)
+
+	for _, line := range lines {
+		cells := []string{}
+		for _, cell := range line {
+			cells = append(cells, strings.ReplaceAll(cell, "|", "\\|"))
+		}
+
+		if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | ")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+
+	return writer.Error()
+}
+
+// writeYAML writes the rows as a list of mappings, keeping the keys in the
+// same order as the columns.
+func writeYAML(w io.Writer, header []string, rows [][]string) error {
+	list := &yaml.Node{Kind: yaml.SequenceNode}
+
+	for _, row := range rows {
+		mapping := &yaml.Node{Kind: yaml.MappingNode}
+		for i, cell := range row {
+			mapping.Content = append(mapping.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: header[i]},
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: cell},
+			)
+		}
+		list.Content = append(list.Content, mapping)
+	}
+
+	return encodeYAML(w, list)
+}
+
+// writeJSON writes the rows as an array of objects, keeping the keys in the
+// same order as the columns.
+func writeJSON(w io.Writer, header []string, rows [][]string) error {
+	var buf bytes.Buffer
+
+	buf.WriteString("[")
+	for i, row := range rows {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n  {")
+
+		for j, cell := range row {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+
+			key, _ := json.Marshal(header[j])
+			value, _ := json.Marshal(cell)
+			fmt.Fprintf(&buf, "%s: %s", key, value)
+		}
+
+		buf.WriteString("}")
+	}
+	if len(rows) > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("]\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// JSONToYAML converts a JSON document to YAML, keeping the order of the keys.
+func JSONToYAML(w io.Writer, body []byte) error {
+	// YAML is a superset of JSON, so the document can be parsed as YAML
+	// and written back in block style.
+	var document yaml.Node
+	if err := yaml.Unmarshal(body, &document); err != nil {
+		return err
+	}
+
+	resetStyle(&document)
+
+	return encodeYAML(w, &document)
+}
+
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
+
+func encodeYAML(w io.Writer, node *yaml.Node) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(node); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// LoadConfig reads the tf.yaml of the working directory, reporting the errors
+// to the user.
+func LoadConfig(wd string) tf.Config {
+	config, err := tf.LoadConfig(wd)
+	if err != nil {
+		Error(err.Error())
+	}
+
+	return config
+}
+
+// LoadGraph builds the dependency graph of the components, reporting the
+// errors to the user.
+func LoadGraph(wd string, components []string) *tf.Graph {
+	graph, err := tf.NewGraph(components, LoadConfig(wd))
+	if err != nil {
+		Error(fmt.Sprintf("Invalid dependencies in %s: %s", tf.ConfigFile, err))
+	}
+
+	return graph
+}
+
+// CmdGraph is run for the "graph" command.
+func CmdGraph(args []string) {
+	fs := NewFlagSet("graph")
+	format := fs.String("format", FormatTable, "Output format: table, dot")
+	ParseFlags(fs, args)
+
+	CheckFormat(*format, []string{FormatTable, "dot"})
+
+	wd, components := FindComponents()
+	graph := LoadGraph(wd, components)
+
+	if *format == "dot" {
+		fmt.Printf("digraph components {\n")
+		for _, component := range graph.Order() {
+			fmt.Printf("  %q;\n", component)
+			for _, dependency := range graph.Dependencies(component) {
+				fmt.Printf("  %q -> %q;\n", component, dependency)
+			}
+		}
+		fmt.Printf("}\n")
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer writer.Flush()
+
+	for i, level := range graph.Levels() {
+		for _, component := range level {
+			dependencies := ""
+			if len(graph.Dependencies(component)) > 0 {
+				dependencies = "after " + strings.Join(graph.Dependencies(component), ", ")
+			}
+
+			fmt.Fprintf(writer, "%d\t%s\t%s\n", i+1, component, dependencies)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// CmdHistory is run for the "history" command.
+func CmdHistory(args []string) {
+	fs := NewFlagSet("history")
+	format := fs.String("format", FormatTable, "Output format: "+strings.Join(Formats, ", "))
+	user := fs.String("user", "", "Only show the commands run by this user")
+	command := fs.String("command", "", "Only show this command: "+strings.Join(tf.AuditedCommands, ", "))
+	since := fs.Duration("since", 0, "Only show the commands run in this last duration, like 24h")
+	failed := fs.Bool("failed", false, "Only show the commands that failed")
+	limit := fs.Int("limit", 20, "Show at most this many of the most recent commands, 0 for all")
+	positional := ParseFlags(fs, args)
+
+	CheckFormat(*format, Formats)
+	if *command != "" && contains(tf.AuditedCommands, *command) == false {
+		Error(fmt.Sprintf("Unknown command '%s', it should be one of: %s", *command, strings.Join(tf.AuditedCommands, ", ")))
+	}
+
+	pattern := ""
+	if len(positional) > 0 {
+		pattern = tf.NormalizeComponent(positional[0])
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		InternalError("Could not find the current working directory", err)
+	}
+
+	entries, err := tf.ReadAuditLog(wd)
+	if err != nil {
+		Error(fmt.Sprintf("Could not read the audit log: %s", err))
+	}
+
+	selected := []tf.AuditEntry{}
+	for _, entry := range entries {
+		if pattern != "" {
+			matched, err := tf.MatchComponents(pattern, []string{entry.Component})
+			if err != nil {
+				Error(err.Error())
+			}
+			if len(matched) == 0 {
+				continue
+			}
+		}
+		if *user != "" && entry.User != *user {
+			continue
+		}
+		if *command != "" && entry.Command != *command {
+			continue
+		}
+		if *since > 0 && time.Since(entry.Time) > *since {
+			continue
+		}
+		if *failed && entry.Failed() == false {
+			continue
+		}
+
+		selected = append(selected, entry)
+	}
+
+	// The most recent commands are the last ones.
+	if *limit > 0 && len(selected) > *limit {
+		selected = selected[len(selected)-*limit:]
+	}
+
+	rows := [][]string{}
+	for _, entry := range selected {
+		changes := ""
+		if entry.Changes != nil {
+			changes = fmt.Sprintf("+%d ~%d -%d", entry.Changes.Add, entry.Changes.Change, entry.Changes.Destroy)
+		}
+
+		tests := ""
+		if len(entry.Tests) > 0 {
+			tests = fmt.Sprintf("%d/%d passed", tf.CountPassed(entry.Tests), len(entry.Tests))
+		}
+
+		duration := time.Duration(entry.Duration * float64(time.Second)).Round(time.Second)
+
+		rows = append(rows, []string{
+			entry.Time.Local().Format("2006-01-02 15:04:05"),
+			entry.User,
+			entry.Command,
+			entry.Component,
+			entry.Workspace,
+			fmt.Sprintf("%d", entry.ExitCode),
+			changes,
+			duration.String(),
+			tests,
+		})
+	}
+
+	header := []string{"time", "user", "command", "component", "workspace", "exit_code", "changes", "duration", "tests"}
+	if err := WriteRows(os.Stdout, *format, header, rows); err != nil {
+		InternalError("Could not write the history", err)
+	}
+}
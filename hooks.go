@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// WithHooks runs the before_plan hook of the component and then run, and the
+// on_failure hook if any of them failed. Cancelling isn't failing, so it
+// doesn't run the on_failure hook. The error of run is returned.
+func WithHooks(runner *tf.Runner, component string, run func() error) error {
+	err := runner.RunHook(component, tf.HookBeforePlan)
+	if err == nil {
+		err = run()
+	}
+
+	if err != nil && errors.Is(err, tf.ErrCancelled) == false {
+		RunFailureHook(runner, component)
+	}
+
+	return err
+}
+
+// RunFailureHook runs the on_failure hook of the component, only reporting
+// its failure since the component already failed.
+func RunFailureHook(runner *tf.Runner, component string) {
+	if err := runner.RunHook(component, tf.HookOnFailure); err != nil {
+		fmt.Fprintf(runner.Stderr, "Warning: %s\n", err)
+	}
+}
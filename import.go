@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+)
+
+// CmdImport is run for the "import" command.
+func CmdImport(args []string) {
+	fs := NewFlagSet("import")
+	AddEnvFlag(fs)
+	AddInitFlag(fs)
+	AddVarFlags(fs)
+	positional, terraformArgs := ParseFlagsWithTerraformArgs(fs, args)
+
+	component := ComponentArg(positional)
+	if len(positional) != 3 {
+		Error(fmt.Sprintf("The import command needs the address and the id of the resource, like in: tf import %s aws_s3_bucket.main my-bucket", component))
+	}
+	address, id := positional[1], positional[2]
+
+	runner := NewRunner()
+	if err := EnsureInit(runner, component); err != nil {
+		Error(fmt.Sprintf("Could not initialize '%s': %s", component, err))
+	}
+
+	unlock, err := LockComponent(runner, component, "import")
+	if err != nil {
+		Error(err.Error())
+	}
+
+	// terraform only accepts its options before the address and the id.
+	importArgs := append([]string{"import"}, VarArgs(runner, component, terraformArgs)...)
+	err = runner.Run(component, append(importArgs, address, id)...)
+	unlock()
+	ExitOnError(err)
+}
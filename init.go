@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// CmdInit is run for the "init" command.
+func CmdInit(args []string) {
+	fs := NewFlagSet("init")
+	AddEnvFlag(fs)
+	upgrade := fs.Bool("upgrade", false, "Same as terraform's -upgrade")
+	AddParallelFlag(fs)
+	positional, terraformArgs := ParseFlagsWithTerraformArgs(fs, args)
+
+	tfArgs := []string{}
+	if *upgrade {
+		tfArgs = append(tfArgs, "-upgrade")
+	}
+	tfArgs = append(tfArgs, terraformArgs...)
+
+	runner := NewRunner()
+
+	if len(positional) > 0 && tf.IsPattern(positional[0]) {
+		order := PatternGraph(positional[0]).Order()
+		PrintComponents(fmt.Sprintf("These components match '%s' and will be initialized", positional[0]), order)
+
+		noBlockers := func(string) []string { return nil }
+
+		results := RunComponents(runner, "Initializing", order, noBlockers, func(runner *tf.Runner, component string) error {
+			return runner.Init(component, tfArgs...)
+		})
+
+		if PrintSummary(results) == false {
+			os.Exit(1)
+		}
+		return
+	}
+
+	component := ComponentArg(positional)
+
+	ExitOnError(runner.Init(component, tfArgs...))
+}
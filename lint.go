@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// CmdLint is run for the "lint" command.
+func CmdLint(args []string) {
+	fs := NewFlagSet("lint")
+	all := fs.Bool("all", false, "Lint all the components")
+	AddParallelFlag(fs)
+	positional := ParseFlags(fs, args)
+
+	if _, err := exec.LookPath(tf.TflintBinary); err != nil {
+		Error("tflint was not found in the PATH, install it from https://github.com/terraform-linters/tflint")
+	}
+
+	// Linting doesn't change anything, so the components are linted at the
+	// same time unless --parallel says otherwise.
+	if IsFlagSet(fs, "parallel") == false {
+		parallel = runtime.NumCPU()
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		InternalError("Could not find the current working directory", err)
+	}
+
+	var order []string
+	if *all {
+		_, components := FindComponents()
+		order = LoadGraph(wd, components).Order()
+	} else if len(positional) > 0 && tf.IsPattern(positional[0]) {
+		order = PatternGraph(positional[0]).Order()
+	} else {
+		order = []string{ComponentArg(positional)}
+		parallel = 1
+	}
+
+	runner := NewRunner()
+	issues := map[string][]tf.LintIssue{}
+	var mu sync.Mutex
+
+	noBlockers := func(string) []string { return nil }
+
+	results := RunComponents(runner, "Linting", order, noBlockers, func(runner *tf.Runner, component string) error {
+		found, err := runner.Lint(wd, component)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		issues[component] = found
+		mu.Unlock()
+
+		if len(found) > 0 {
+			return fmt.Errorf("%d issues", len(found))
+		}
+
+		return nil
+	})
+
+	ok := PrintSummary(results)
+
+	if runner.DryRun {
+		if ok == false {
+			os.Exit(1)
+		}
+		return
+	}
+
+	total := 0
+	for _, result := range results {
+		found := issues[result.Component]
+		if len(found) == 0 {
+			continue
+		}
+
+		fmt.Printf("\n%s:\n", result.Component)
+		for _, issue := range found {
+			fmt.Printf("  %s\n", issue)
+		}
+		total += len(found)
+	}
+
+	if total == 0 {
+		fmt.Printf("\nNo issues found.\n")
+	} else {
+		fmt.Printf("\n%d issues found.\n", total)
+	}
+
+	if ok == false {
+		os.Exit(1)
+	}
+}
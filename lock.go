@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// heldLocks are the functions that release the locks held by tf, by
+// component.
+var (
+	heldLocks = map[string]func() error{}
+	locksMu   sync.Mutex
+)
+
+// LockComponent locks the component while the command changes it, so that
+// nobody else can apply or destroy it at the same time, and returns the
+// function that releases the lock. The component is locked in the files of
+// the directory, and in the remote backend of tf.yaml if there is one. In
+// dry-run mode nothing is locked.
+func LockComponent(runner *tf.Runner, component string, command string) (func(), error) {
+	if runner.DryRun {
+		return func() {}, nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("could not find the current working directory: %w", err)
+	}
+
+	release, err := tf.AcquireLock(wd, component, command)
+	if err == nil {
+		var releaseRemote func() error
+		if releaseRemote, err = tf.AcquireRemoteLock(runner.Locks, component, command); err != nil {
+			release()
+		} else {
+			releaseLocal := release
+			release = func() error {
+				remoteErr := releaseRemote()
+				if err := releaseLocal(); err != nil {
+					return err
+				}
+				return remoteErr
+			}
+		}
+	}
+	if _, ok := err.(*tf.LockedError); ok {
+		return nil, fmt.Errorf("%s. If nobody is running it, remove the lock with: tf unlock %s", err, component)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not lock '%s': %w", component, err)
+	}
+
+	locksMu.Lock()
+	heldLocks[component] = release
+	locksMu.Unlock()
+
+	return func() {
+		locksMu.Lock()
+		defer locksMu.Unlock()
+
+		if release, ok := heldLocks[component]; ok {
+			release()
+			delete(heldLocks, component)
+		}
+	}, nil
+}
+
+// ReleaseLocks releases all the locks that tf still holds. It is called
+// before exiting with an error, since os.Exit doesn't run the deferred
+// functions that would release them.
+func ReleaseLocks() {
+	locksMu.Lock()
+	defer locksMu.Unlock()
+
+	for component, release := range heldLocks {
+		release()
+		delete(heldLocks, component)
+	}
+}
+
+// HandleSignals makes tf stop gracefully when it is interrupted or
+// terminated, instead of leaving terraform running and the locks behind: the
+// signal is forwarded to terraform, and once it has exited the locks are
+// released and tf exits. The interrupts of a terminal are not forwarded,
+// since terraform already got them, and a second one would make it exit
+// right away without saving the state.
+func HandleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		exiting := false
+		for received := range signals {
+			if received != os.Interrupt || isTerminal(os.Stdin) == false {
+				tf.Interrupt(received)
+			} else {
+				tf.Interrupt(nil)
+			}
+
+			if exiting {
+				continue
+			}
+			exiting = true
+
+			go func(received os.Signal) {
+				tf.WaitRunning()
+				beforeExit()
+
+				if received == os.Interrupt {
+					os.Exit(130)
+				}
+				os.Exit(143)
+			}(received)
+		}
+	}()
+}
+
+// CmdUnlock is run for the "unlock" command.
+func CmdUnlock(args []string) {
+	fs := NewFlagSet("unlock")
+	component := ComponentArg(ParseFlags(fs, args))
+
+	wd, err := os.Getwd()
+	if err != nil {
+		InternalError("Could not find the current working directory", err)
+	}
+
+	config := LoadConfig(wd).Locks
+
+	lock, err := tf.ReadLock(wd, component)
+	if os.IsNotExist(err) {
+		lock, err = tf.ReadRemoteLock(config, component)
+	}
+	if os.IsNotExist(err) {
+		Error(fmt.Sprintf("'%s' is not locked", component))
+	}
+
+	held := "someone"
+	if err == nil {
+		held = lock.String()
+	}
+
+	if err := tf.RemoveLock(wd, component); err != nil && os.IsNotExist(err) == false {
+		InternalError("Could not remove the lock", err)
+	}
+	if err := tf.RemoveRemoteLock(config, component); err != nil {
+		InternalError("Could not remove the lock in Consul", err)
+	}
+
+	fmt.Printf("Removed the lock of '%s', held by %s\n", component, held)
+}
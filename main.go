@@ -1,230 +1,267 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
-	"path"
-	"path/filepath"
 	"strings"
-	"text/tabwriter"
-)
 
-var (
-	ErrTooManyFiles = errors.New("Too many files in this sub-directory")
+	"github.com/fallertsen/tf/pkg/tf"
 )
 
 func PrintUsage() {
 	fmt.Printf("Usage: tf <command> [args]\n\n")
 	fmt.Printf("Available commands:\n")
 	fmt.Printf("  status                     - Get the status of all the components\n")
-	fmt.Printf("  output <component>         - Run the 'output' of the component\n")
-	fmt.Printf("  plan <component>           - Run the 'plan' of the component\n")
-	fmt.Printf("  apply <component> [-yes]   - Run the 'apply' of the component (-yes is the same as -auto-approve)\n")
+	fmt.Printf("    [--format <format>]        table, markdown, csv, yaml or json\n")
+	fmt.Printf("    [--columns <columns>]      comma separated columns: name, status, resources, provider_resources,\n")
+	fmt.Printf("                               last_applied, path, backend, version, providers, owner, tier,\n")
+	fmt.Printf("                               description, labels\n")
+	fmt.Printf("    [--label <key=value>]      only show the components with this label\n")
+	fmt.Printf("    [--only <status>]          only show the components that are applied, destroyed or unknown\n")
+	fmt.Printf("    [--filter <pattern>]       only show the components that match the pattern, like 'network/*'\n")
+	fmt.Printf("    [--jobs <n>]               read n components at the same time (default: number of CPUs)\n")
+	fmt.Printf("    [--providers]              list the providers of every component instead\n")
+	fmt.Printf("    [--watch]                  refresh the status every --interval (default: 5s) until Ctrl-C\n")
+	fmt.Printf("  output <component>         - Run the 'output' of the component (--format json or yaml)\n")
+	fmt.Printf("  output snapshot            - Save the outputs of all the components in .tf/snapshots\n")
+	fmt.Printf("  output diff [<snapshot>]   - Show the outputs that changed since the snapshot (default: latest)\n")
+	fmt.Printf("  init <component>           - Run the 'init' of the component (--upgrade is the same as -upgrade)\n")
+	fmt.Printf("  plan <component>           - Plan the component and summarize its changes\n")
+	fmt.Printf("    [--detail]                 show the full output of terraform instead\n")
+	fmt.Printf("    [--out]                    save the plan in .tf/plans/<component>, to apply it with --plan\n")
+	fmt.Printf("    [--format github-comment]  print the summary as Markdown for a pull request comment (plan-all too)\n")
+	fmt.Printf("                               (init, plan, apply and destroy also accept patterns like 'network/*' or 'envs/prod/**')\n")
+	fmt.Printf("  plan-all                   - Plan all the components and summarize their changes\n")
+	fmt.Printf("  apply <component> [-yes]   - Plan the component, show where and what it changes, and apply exactly that plan\n")
+	fmt.Printf("                               once confirmed (-yes applies without asking, like -auto-approve)\n")
+	fmt.Printf("    [--review]                 save and summarize the plan even with -yes\n")
+	fmt.Printf("    [--plan <file|latest>]     apply a plan saved with 'plan --out'\n")
+	fmt.Printf("    [--no-policy]              don't check the plan against the policies of the policy folder\n")
+	fmt.Printf("  apply-all [-yes]           - Apply all the components, dependencies first\n")
 	fmt.Printf("  destroy <component> [-yes] - Run the 'destroy' of the component (-yes is the same as -auto-approve)\n")
+	fmt.Printf("  drift <component> [--all]  - Report the components whose resources changed outside of terraform (exit code 2)\n")
+	fmt.Printf("  import <comp> <addr> <id>  - Import an existing resource in the component, like 'terraform import'\n")
+	fmt.Printf("  taint <comp> <address>     - Mark a resource to be replaced by the next apply (untaint undoes it)\n")
+	fmt.Printf("  state <component> <args>   - Run 'terraform state <args>' in the component, like 'list' or 'mv <from> <to>'\n")
+	fmt.Printf("  cost <component> [--all]   - Estimate how the monthly cost of the components changes with their plan (needs infracost)\n")
+	fmt.Printf("  validate <comp> [--all]    - Validate the components at the same time, initializing them without backend\n")
+	fmt.Printf("  lint <component> [--all]   - Run tflint in the components with the shared .tflint.hcl and report their issues\n")
+	fmt.Printf("  fmt [--check]              - Format the files of all the components and their local modules\n")
+	fmt.Printf("  history [<component>]      - Show the plans, applies and destroys recorded in .tf/audit.jsonl\n")
+	fmt.Printf("    [--user <user>] [--command <command>] [--since <duration>] [--failed] [--limit <n>] [--format <format>]\n")
+	fmt.Printf("  graph [--format dot]       - Show the order of the components from the depends_on in tf.yaml\n")
+	fmt.Printf("  describe <component>       - Show the metadata, backend, providers, variables and outputs of the component\n")
+	fmt.Printf("  destroy-all [-yes]         - Destroy all the components, dependents first\n")
+	fmt.Printf("  unlock <component>         - Remove the lock of a component that is not being applied or destroyed anymore\n")
+	fmt.Printf("  ui                         - Browse the components in a terminal UI, and plan or apply them\n")
+	fmt.Printf("  serve [--listen <addr>]    - Serve an HTTP API to list the components, read their status, plan, apply or check\n")
+	fmt.Printf("                               their drift, with Prometheus metrics on /metrics\n")
+	fmt.Printf("    [--token <token>]          token the clients have to send (default: $TF_SERVE_TOKEN)\n")
+	fmt.Printf("    [--parallel <n>]           read the status of n components at a time (default: 1)\n")
+	fmt.Printf("  daemon [--interval <dur>]  - Check the drift of all the components every interval (default: 6h) and notify it\n")
+	fmt.Printf("    [--listen <addr>]          also serve the API and the metrics of 'serve'\n")
+	fmt.Printf("  completion <shell>         - Print the completion script for bash, zsh or fish\n")
+	fmt.Printf("  doctor                     - Check that the environment has everything tf needs\n")
+	fmt.Printf("\nplan, apply, output, import, taint and state run 'init' first when the component is not initialized, unless --no-init is passed.\n")
+	fmt.Printf("status, init, output, plan, apply, destroy, import, taint, state and the -all commands accept --env <environment>.\n")
+	fmt.Printf("plan, apply, destroy, import and the -all commands accept -var <key=value> and -var-file <file>.\n")
+	fmt.Printf("The -all commands, drift and the patterns accept --parallel <n> to run n independent components at once.\n")
+	fmt.Printf("Arguments after -- are passed to terraform, like in: tf plan <component> -- -target=<address>\n")
+	fmt.Printf("\nEvery command accepts --dry-run to print the terraform commands instead of running them,\n")
+	fmt.Printf("and --show-commands to print them to stderr as they are run.\n")
+	fmt.Printf("They also accept --binary <binary> (or TF_BINARY) to run another binary, like tofu.\n")
+	fmt.Printf("The components found are cached in .tf/cache.json, --no-cache searches all the directories again.\n")
+	fmt.Printf("--exclude <pattern> ignores the components that match the pattern, like the exclude of tf.yaml.\n")
+	fmt.Printf("--max-depth <n> only searches n levels of directories for components, and --follow-symlinks\n")
+	fmt.Printf("also searches the directories the symbolic links point to.\n")
+	fmt.Printf("With -v they log the commands they run and how long they take to stderr, and with --debug everything they do.\n")
+	fmt.Printf("\nThe commands on a single component exit with the exit code of terraform when it fails.\n")
+	fmt.Printf("Any other command runs the 'tf-<command>' executable found in the PATH.\n")
+}
+
+// restoreTerminal restores the terminal before exiting, when a command like
+// ui changed it.
+var restoreTerminal func()
+
+// beforeExit releases the locks, removes the var files with the outputs of
+// the components and restores the terminal, since os.Exit doesn't run the
+// deferred functions that would do it. The errors are
+// printed after it, so that they are not lost in the screen of tf ui.
+func beforeExit() {
+	ReleaseLocks()
+	tf.RemoveOutputsVarFiles()
+	if restoreTerminal != nil {
+		restoreTerminal()
+	}
 }
 
 // InternalError is an error that is unexpected and should not happen.
 func InternalError(msg string, err error) {
+	beforeExit()
 	fmt.Printf("Internal error: %s - %s", msg, err)
 	os.Exit(2)
 }
 
 // Error is an error that can happen and we need to report it to the user.
 func Error(msg string) {
+	beforeExit()
 	fmt.Printf("Error: %s\n", msg)
 	os.Exit(1)
 }
 
-// FindAllComponents finds all the components in all the subfolders of the
-// directory passed as argument. If we are going to scan too many files we are
-// going to report an error, because it was probably not the intention of the
-// user to run this command on that directory (for example the root directory).
-func FindAllComponents(wd string) ([]string, error) {
-	const MAX_FILES = 1_000
-
-	components := []string{}
-
-	numWalks := 0
-
-	err := filepath.Walk(wd, func(path string, info os.FileInfo, err error) error {
-		numWalks += 1
-		if numWalks > MAX_FILES {
-			return ErrTooManyFiles
-		}
-
-		if err != nil {
-			return err
-		}
+// ExitOnError exits with the exit code of terraform if err is a terraform
+// command that failed, since terraform already reported why, or reports any
+// other error to the user. A terraform killed by a signal exits with 1.
+func ExitOnError(err error) {
+	if err == nil {
+		return
+	}
 
-		if info.Name() != "main.tf" {
-			return nil
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		beforeExit()
+		if exitErr.ExitCode() > 0 {
+			os.Exit(exitErr.ExitCode())
 		}
-
-		// The component name should be the relative path between the
-		// working directory and the main.tf.
-		component := strings.TrimPrefix(path, wd)
-		component = strings.TrimPrefix(component, "/")
-		component = strings.TrimSuffix(component, "/main.tf")
-
-		components = append(components, component)
-
-		return nil
-	})
-	if err != nil {
-		return []string{}, err
+		os.Exit(1)
 	}
 
-	return components, nil
+	Error(err.Error())
 }
 
-// GetStatus returns "destroyed" or "applied" depending on the status of the
-// component.
-func GetStatus(component string) string {
-	tfstateFile := path.Join(component, "terraform.tfstate")
-
-	if _, err := os.Stat(tfstateFile); os.IsNotExist(err) {
-		return "destroyed"
-	}
-
-	tfstateBody, err := ioutil.ReadFile(tfstateFile)
-	if err != nil {
-		InternalError(fmt.Sprintf("GetStatus: Could not read the terraform.tfstate of component '%s'", component), err)
+// CheckComponent reports an error to the user if the component doesn't exist
+// or if it is not a folder.
+func CheckComponent(component string) {
+	err := tf.CheckComponent(component)
+	if err == tf.ErrComponentNotFound {
+		Error(fmt.Sprintf("Component '%s' not found", component))
 	}
-
-	type tfState struct {
-		Resources []struct {
-			Type string `json:"type"`
-		} `json:"resources"`
+	if err == tf.ErrComponentNotDir {
+		Error(fmt.Sprintf("Component '%s' is not a folder", component))
 	}
-
-	var s tfState
-	err = json.Unmarshal(tfstateBody, &s)
 	if err != nil {
-		InternalError("GetStatus: Could not unmarshal terraform.tfstate", err)
-	}
-
-	if len(s.Resources) == 0 {
-		return "destroyed"
+		InternalError("CheckComponent failed", err)
 	}
-
-	return "applied"
 }
 
-// CmdStatus is run for the "status" command.
-func CmdStatus() {
+// FindComponents returns the current working directory and all the
+// components found in it following the roots and the exclusions of tf.yaml,
+// reporting the errors to the user.
+func FindComponents() (string, []string) {
 	wd, err := os.Getwd()
 	if err != nil {
 		InternalError("Could not find the current working directory", err)
 	}
 
-	components, err := FindAllComponents(wd)
-	if err == ErrTooManyFiles {
-		Error("We found more than 1000 files in the subdirectories, maybe you should try to run the command on a subdirectory with less files")
+	config := LoadConfig(wd)
+	if maxFiles.IsSet {
+		config.MaxFiles = &maxFiles.Value
 	}
-	if err != nil {
-		InternalError("FindAllComponents failed", err)
+	if maxDepth.IsSet {
+		config.MaxDepth = maxDepth.Value
+	}
+	if symlinks {
+		config.FollowSymlinks = true
 	}
+	config.Exclude = append(config.Exclude, excludes...)
 
-	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
-	defer writer.Flush()
+	components, err := config.FindComponents(wd)
+	if err == tf.ErrTooManyFiles {
+		Error(fmt.Sprintf("We found more than %d files in the subdirectories, maybe you should try to run the command on a subdirectory with less files, set the roots in tf.yaml, or raise the limit with --max-files or max_files in tf.yaml (0 for no limit)", config.WalkOptions().MaxFiles))
+	}
+	if err != nil {
+		InternalError("FindComponents failed", err)
+	}
 
-	for _, component := range components {
-		status := GetStatus(component)
+	return wd, components
+}
 
-		fmt.Fprintf(writer, "%s\t%s\n", component, status)
+// ComponentArg returns the component passed as first argument of a command,
+// printing the usage if it is missing.
+func ComponentArg(args []string) string {
+	if len(args) < 1 {
+		PrintUsage()
+		os.Exit(1)
 	}
+
+	component := tf.NormalizeComponent(args[0])
+	CheckComponent(component)
+
+	return component
 }
 
-// CmdStatus is run for the "output" command.
-func CmdOutput() {
-	component := os.Args[2]
+// PatternGraph returns the dependency graph of the components that match the
+// pattern, reporting an error to the user if none of them does.
+func PatternGraph(pattern string) *tf.Graph {
+	wd, components := FindComponents()
 
-	stat, err := os.Stat(component)
-	if os.IsNotExist(err) {
-		Error(fmt.Sprintf("Component '%s' not found", component))
+	matched, err := tf.MatchComponents(pattern, components)
+	if err != nil {
+		Error(err.Error())
 	}
-	if stat.IsDir() == false {
-		Error(fmt.Sprintf("Component '%s' is not a folder", component))
+	if len(matched) == 0 {
+		Error(fmt.Sprintf("No component matches '%s'", pattern))
 	}
 
-	cmd := exec.Command("terraform", "output")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	cmd.Dir = component
-	cmd.Run()
+	return LoadGraph(wd, components).Subgraph(matched)
 }
 
-// CmdStatus is run for the "plan" command.
-func CmdPlan() {
-	component := os.Args[2]
-
-	stat, err := os.Stat(component)
-	if os.IsNotExist(err) {
-		Error(fmt.Sprintf("Component '%s' not found", component))
-	}
-	if stat.IsDir() == false {
-		Error(fmt.Sprintf("Component '%s' is not a folder", component))
+// PrintComponents prints the components that are going to be run, in the
+// order they are going to be run.
+func PrintComponents(title string, components []string) {
+	fmt.Printf("%s:\n", title)
+	for _, component := range components {
+		fmt.Printf("  - %s\n", component)
 	}
-
-	cmd := exec.Command("terraform", "plan")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	cmd.Dir = component
-	cmd.Run()
 }
 
-// CmdStatus is run for the "apply" command.
-func CmdApply() {
-	component := os.Args[2]
+// CmdDoctor is run for the "doctor" command.
+func CmdDoctor(args []string) {
+	fs := NewFlagSet("doctor")
+	ParseFlags(fs, args)
 
-	stat, err := os.Stat(component)
-	if os.IsNotExist(err) {
-		Error(fmt.Sprintf("Component '%s' not found", component))
-	}
-	if stat.IsDir() == false {
-		Error(fmt.Sprintf("Component '%s' is not a folder", component))
+	wd, err := os.Getwd()
+	if err != nil {
+		InternalError("Could not find the current working directory", err)
 	}
 
-	cmd := exec.Command("terraform", "apply")
-	if os.Args[3] == "-yes" {
-		cmd = exec.Command("terraform", "apply", "-auto-approve")
-	}
+	// A broken tf.yaml is one of the things reported by the checks.
+	config, _ := tf.LoadConfig(wd)
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	cmd.Dir = component
-	cmd.Run()
-}
+	failed := false
 
-// CmdStatus is run for the "destroy" command.
-func CmdDestroy() {
-	component := os.Args[2]
+	for _, check := range tf.Diagnose(wd, SelectedBinary(config)) {
+		fmt.Printf("[%s] %s: %s\n", strings.ToUpper(check.Result), check.Name, check.Message)
+		if check.Hint != "" {
+			fmt.Printf("       hint: %s\n", check.Hint)
+		}
 
-	stat, err := os.Stat(component)
-	if os.IsNotExist(err) {
-		Error(fmt.Sprintf("Component '%s' not found", component))
+		if check.Result == tf.CheckFail {
+			failed = true
+		}
 	}
-	if stat.IsDir() == false {
-		Error(fmt.Sprintf("Component '%s' is not a folder", component))
+
+	if failed {
+		os.Exit(1)
 	}
+}
 
-	cmd := exec.Command("terraform", "destroy")
-	if os.Args[3] == "-yes" {
-		cmd = exec.Command("terraform", "destroy", "-auto-approve")
+// CmdPlugin is run for the commands that are implemented by a plugin.
+func CmdPlugin(plugin string, args []string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		InternalError("Could not find the current working directory", err)
 	}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	cmd.Dir = component
-	cmd.Run()
+	err = tf.RunPlugin(plugin, tf.NewPluginContext(wd, args), os.Stdout, os.Stderr)
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		InternalError("Could not run the plugin", err)
+	}
 }
 
 func main() {
@@ -233,16 +270,72 @@ func main() {
 		os.Exit(1)
 	}
 
+	args := os.Args[2:]
+	HandleSignals()
+
+	// The default flags of tf.yaml go first, so that the ones in the
+	// command line win over them. A broken tf.yaml is reported by the
+	// commands that read it, and not here, so that doctor still works.
+	if wd, err := os.Getwd(); err == nil {
+		if config, err := tf.LoadConfig(wd); err == nil {
+			args = append(config.Flags[os.Args[1]], args...)
+		}
+	}
+
 	if os.Args[1] == "status" {
-		CmdStatus()
+		CmdStatus(args)
 	} else if os.Args[1] == "output" {
-		CmdOutput()
+		CmdOutput(args)
+	} else if os.Args[1] == "init" {
+		CmdInit(args)
 	} else if os.Args[1] == "plan" {
-		CmdPlan()
+		CmdPlan(args)
+	} else if os.Args[1] == "plan-all" {
+		CmdPlanAll(args)
 	} else if os.Args[1] == "apply" {
-		CmdApply()
+		CmdApply(args)
+	} else if os.Args[1] == "apply-all" {
+		CmdApplyAll(args)
 	} else if os.Args[1] == "destroy" {
-		CmdDestroy()
+		CmdDestroy(args)
+	} else if os.Args[1] == "drift" {
+		CmdDrift(args)
+	} else if os.Args[1] == "import" {
+		CmdImport(args)
+	} else if os.Args[1] == "taint" || os.Args[1] == "untaint" {
+		CmdTaint(os.Args[1], args)
+	} else if os.Args[1] == "state" {
+		CmdState(args)
+	} else if os.Args[1] == "cost" {
+		CmdCost(args)
+	} else if os.Args[1] == "validate" {
+		CmdValidate(args)
+	} else if os.Args[1] == "lint" {
+		CmdLint(args)
+	} else if os.Args[1] == "fmt" {
+		CmdFmt(args)
+	} else if os.Args[1] == "history" {
+		CmdHistory(args)
+	} else if os.Args[1] == "graph" {
+		CmdGraph(args)
+	} else if os.Args[1] == "describe" {
+		CmdDescribe(args)
+	} else if os.Args[1] == "destroy-all" {
+		CmdDestroyAll(args)
+	} else if os.Args[1] == "unlock" {
+		CmdUnlock(args)
+	} else if os.Args[1] == "ui" {
+		CmdUI(args)
+	} else if os.Args[1] == "serve" {
+		CmdServe(args)
+	} else if os.Args[1] == "daemon" {
+		CmdDaemon(args)
+	} else if os.Args[1] == "completion" {
+		CmdCompletion(args)
+	} else if os.Args[1] == "doctor" {
+		CmdDoctor(args)
+	} else if plugin, err := tf.FindPlugin(os.Args[1]); err == nil {
+		CmdPlugin(plugin, args)
 	} else {
 		PrintUsage()
 		os.Exit(1)
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics are the results of the drift checks and the applies run by the
+// server, exported on /metrics in the text format of Prometheus so that the
+// drifts and the failed applies can be alerted on.
+type Metrics struct {
+	components map[string]*componentMetrics
+
+	// jobs are the number of jobs that finished, by command and status.
+	jobs map[[2]string]int
+
+	mu sync.Mutex
+}
+
+// componentMetrics are the metrics of a component. The components whose
+// drift was never checked, or that were never applied, have no value for
+// those metrics.
+type componentMetrics struct {
+	checked bool
+	drifted bool
+
+	applied       bool
+	applyDuration time.Duration
+	applyFailures int
+}
+
+// NewMetrics returns metrics without anything recorded.
+func NewMetrics() *Metrics {
+	return &Metrics{components: map[string]*componentMetrics{}, jobs: map[[2]string]int{}}
+}
+
+// component returns the metrics of the component. It has to be called with
+// the lock.
+func (m *Metrics) component(component string) *componentMetrics {
+	if m.components[component] == nil {
+		m.components[component] = &componentMetrics{}
+	}
+
+	return m.components[component]
+}
+
+// RecordDrift records the result of the last drift check of the component.
+func (m *Metrics) RecordDrift(component string, drifted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.component(component).checked = true
+	m.component(component).drifted = drifted
+}
+
+// RecordApply records an apply of the component that took duration and
+// finished with err.
+func (m *Metrics) RecordApply(component string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	metrics := m.component(component)
+	metrics.applied = true
+	metrics.applyDuration = duration
+	if err != nil {
+		metrics.applyFailures++
+	}
+}
+
+// RecordJob records a job that finished with the status.
+func (m *Metrics) RecordJob(command string, status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.jobs[[2]string{command, status}]++
+}
+
+// Write writes the metrics of the components in the text format of
+// Prometheus. Only the drifts of the components that still exist are
+// counted.
+func (m *Metrics) Write(w io.Writer, components []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out strings.Builder
+
+	writeMetric(&out, "tf_components", "gauge", "Number of components found.")
+	fmt.Fprintf(&out, "tf_components %d\n", len(components))
+
+	drifted := 0
+	for _, component := range components {
+		if metrics, ok := m.components[component]; ok && metrics.drifted {
+			drifted++
+		}
+	}
+	writeMetric(&out, "tf_components_drifted", "gauge", "Number of components that had drifted in their last drift check.")
+	fmt.Fprintf(&out, "tf_components_drifted %d\n", drifted)
+
+	names := []string{}
+	for component := range m.components {
+		names = append(names, component)
+	}
+	sort.Strings(names)
+
+	writeMetric(&out, "tf_component_drifted", "gauge", "1 if the component had drifted in its last drift check, 0 if not.")
+	for _, component := range names {
+		if m.components[component].checked == false {
+			continue
+		}
+
+		value := 0
+		if m.components[component].drifted {
+			value = 1
+		}
+		fmt.Fprintf(&out, "tf_component_drifted{component=\"%s\"} %d\n", metricLabel(component), value)
+	}
+
+	writeMetric(&out, "tf_last_apply_duration_seconds", "gauge", "Duration of the last apply of the component.")
+	for _, component := range names {
+		if m.components[component].applied {
+			fmt.Fprintf(&out, "tf_last_apply_duration_seconds{component=\"%s\"} %g\n", metricLabel(component), m.components[component].applyDuration.Seconds())
+		}
+	}
+
+	writeMetric(&out, "tf_apply_failures_total", "counter", "Number of applies of the component that failed.")
+	for _, component := range names {
+		if m.components[component].applied {
+			fmt.Fprintf(&out, "tf_apply_failures_total{component=\"%s\"} %d\n", metricLabel(component), m.components[component].applyFailures)
+		}
+	}
+
+	writeMetric(&out, "tf_jobs_total", "counter", "Number of jobs that finished, by command and status.")
+	keys := [][2]string{}
+	for key := range m.jobs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || (keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1])
+	})
+	for _, key := range keys {
+		fmt.Fprintf(&out, "tf_jobs_total{command=\"%s\",status=\"%s\"} %d\n", key[0], key[1], m.jobs[key])
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func writeMetric(out *strings.Builder, name string, metricType string, help string) {
+	fmt.Fprintf(out, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(out, "# TYPE %s %s\n", name, metricType)
+}
+
+// metricLabel escapes the value of a label, which is quoted.
+func metricLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
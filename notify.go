@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// WithNotifications runs the apply of the component, notifying the webhooks
+// of tf.yaml when it starts and when it succeeds or fails. The number of
+// resources changed is read from the output of terraform, and the results of
+// the smoke tests are sent with the end of the apply.
+func WithNotifications(runner *tf.Runner, component string, run func() error) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("could not find the current working directory: %w", err)
+	}
+
+	projectConfig, err := tf.LoadConfig(wd)
+	if err != nil {
+		return err
+	}
+
+	config := projectConfig.Notifications
+	if config.Enabled() == false {
+		return run()
+	}
+
+	runner.Notify(config, tf.NewNotification(tf.NotifyStarted, component))
+
+	// The results of a previous apply are not the ones of this one.
+	testResults.Lock()
+	delete(testResults.results, component)
+	testResults.Unlock()
+
+	stdout := runner.Stdout
+	counter := tf.NewChangeCounter(stdout)
+	runner.Stdout = counter
+	err = run()
+	runner.Stdout = stdout
+
+	if err != nil {
+		notification := tf.NewNotification(tf.NotifyFailed, component)
+		notification.Changes = counter.Planned
+		notification.Error = err.Error()
+		notification.Tests = TestResults(component)
+		runner.Notify(config, notification)
+	} else {
+		notification := tf.NewNotification(tf.NotifySucceeded, component)
+		notification.Changes = counter.Changes()
+		notification.Tests = TestResults(component)
+		runner.Notify(config, notification)
+	}
+
+	return err
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// CmdOutput is run for the "output" command.
+func CmdOutput(args []string) {
+	fs := NewFlagSet("output")
+	AddEnvFlag(fs)
+	format := fs.String("format", "", "Output format: json, yaml")
+	AddInitFlag(fs)
+	positional, terraformArgs := ParseFlagsWithTerraformArgs(fs, args)
+
+	if len(terraformArgs) > 0 && len(positional) > 0 && (positional[0] == "snapshot" || positional[0] == "diff") {
+		Error(fmt.Sprintf("The output %s command doesn't accept terraform arguments after --", positional[0]))
+	}
+
+	if len(positional) > 0 && positional[0] == "snapshot" {
+		OutputSnapshot()
+		return
+	}
+	if len(positional) > 0 && positional[0] == "diff" {
+		OutputDiff(positional[1:])
+		return
+	}
+
+	component := ComponentArg(positional)
+
+	if *format != "" {
+		CheckFormat(*format, []string{FormatJSON, FormatYAML})
+	}
+
+	runner := NewRunner()
+	if err := EnsureInit(runner, component); err != nil {
+		Error(fmt.Sprintf("Could not initialize '%s': %s", component, err))
+	}
+
+	if *format == "" {
+		ExitOnError(runner.Run(component, append([]string{"output"}, terraformArgs...)...))
+		return
+	}
+
+	if *format == FormatJSON {
+		ExitOnError(runner.Run(component, append([]string{"output", "-json"}, terraformArgs...)...))
+		return
+	}
+
+	outputs, err := runner.Output(component, append([]string{"output", "-json"}, terraformArgs...)...)
+	if err != nil {
+		Error(fmt.Sprintf("Could not get the outputs of '%s': %s", component, err))
+	}
+	if runner.DryRun {
+		return
+	}
+
+	if err := JSONToYAML(os.Stdout, outputs); err != nil {
+		InternalError("Could not convert the outputs to YAML", err)
+	}
+}
+
+// TakeSnapshot reads the outputs of all the components, warning about the
+// ones that can't be read.
+func TakeSnapshot(runner *tf.Runner, components []string) tf.Snapshot {
+	snapshot, failed := runner.TakeSnapshot(components)
+
+	for _, component := range failed {
+		fmt.Fprintf(os.Stderr, "Warning: could not read the outputs of '%s', it is not part of the snapshot\n", component)
+	}
+
+	return snapshot
+}
+
+// OutputSnapshot is run for "output snapshot".
+func OutputSnapshot() {
+	wd, components := FindComponents()
+
+	runner := NewRunner()
+	snapshot := TakeSnapshot(runner, components)
+	if runner.DryRun {
+		return
+	}
+
+	name, err := tf.SaveSnapshot(wd, snapshot)
+	if err != nil {
+		InternalError("Could not save the snapshot", err)
+	}
+
+	fmt.Printf("Saved the outputs of %d components in snapshot '%s'\n", len(snapshot.Outputs), name)
+}
+
+// OutputDiff is run for "output diff".
+func OutputDiff(args []string) {
+	name := "latest"
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	wd, components := FindComponents()
+
+	old, err := tf.LoadSnapshot(wd, name)
+	if err != nil {
+		Error(fmt.Sprintf("Could not load the snapshot '%s': %s", name, err))
+	}
+
+	runner := NewRunner()
+	current := TakeSnapshot(runner, components)
+	if runner.DryRun {
+		return
+	}
+
+	changes := tf.DiffSnapshots(old, current)
+	if len(changes) == 0 {
+		fmt.Printf("No outputs changed since %s\n", old.Time.Format("2006-01-02 15:04:05 MST"))
+		return
+	}
+
+	fmt.Printf("Outputs changed since %s:\n", old.Time.Format("2006-01-02 15:04:05 MST"))
+	for _, change := range changes {
+		switch {
+		case change.Old == "":
+			fmt.Printf("  + %s.%s = %s\n", change.Component, change.Output, change.New)
+		case change.New == "":
+			fmt.Printf("  - %s.%s = %s\n", change.Component, change.Output, change.Old)
+		default:
+			fmt.Printf("  ~ %s.%s = %s -> %s\n", change.Component, change.Output, change.Old, change.New)
+		}
+	}
+}
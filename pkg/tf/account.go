@@ -0,0 +1,113 @@
+package tf
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// CloudAccounts returns the cloud accounts the component is going to change,
+// like "aws 123456789012 (profile prod, region eu-west-1)", for the clouds of
+// its providers. They are read from the environment terraform sees, and the
+// number of the AWS account from the aws CLI when it is installed. The
+// accounts that come from the provider blocks are not known.
+func (r *Runner) CloudAccounts(component string) []string {
+	env := r.environ(component)
+	if env == nil {
+		env = os.Environ()
+	}
+
+	// The variables of the component are after the ones of tf, so they win.
+	vars := map[string]string{}
+	for _, variable := range env {
+		if i := strings.Index(variable, "="); i > 0 {
+			vars[variable[:i]] = variable[i+1:]
+		}
+	}
+
+	// A component without required_providers just has no accounts.
+	providers, _ := r.Providers(component)
+
+	accounts := []string{}
+	for _, provider := range providers {
+		switch provider.Name() {
+		case "aws":
+			accounts = append(accounts, describeAccount("aws", r.awsAccount(component, env), []string{
+				"profile", firstVar(vars, "AWS_PROFILE"),
+				"region", firstVar(vars, "AWS_REGION", "AWS_DEFAULT_REGION"),
+			}))
+		case "google":
+			accounts = append(accounts, describeAccount("google", firstVar(vars, "GOOGLE_PROJECT", "GOOGLE_CLOUD_PROJECT", "CLOUDSDK_CORE_PROJECT"), []string{
+				"region", firstVar(vars, "GOOGLE_REGION", "CLOUDSDK_COMPUTE_REGION"),
+			}))
+		case "azurerm":
+			accounts = append(accounts, describeAccount("azure", firstVar(vars, "ARM_SUBSCRIPTION_ID"), []string{
+				"tenant", firstVar(vars, "ARM_TENANT_ID"),
+			}))
+		}
+	}
+
+	return accounts
+}
+
+// awsAccount returns the number of the AWS account of the credentials of the
+// component, or an empty string if the aws CLI is not installed or fails.
+func (r *Runner) awsAccount(component string, env []string) string {
+	if _, err := exec.LookPath("aws"); err != nil {
+		return ""
+	}
+
+	r.echoCommand("cd " + QuoteArg(component) + " && aws sts get-caller-identity --query Account --output text")
+	if r.DryRun {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "aws", "sts", "get-caller-identity", "--query", "Account", "--output", "text")
+	cmd.Dir = component
+	cmd.Env = env
+
+	out, err := cmd.Output()
+	if err != nil {
+		Log(LogDebug, "could not read the aws account", "component", component, "error", err)
+		return ""
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+// describeAccount returns the cloud with its account and the details that
+// are set, as pairs of name and value.
+func describeAccount(cloud string, account string, details []string) string {
+	if account == "" {
+		account = "unknown account"
+	}
+
+	set := []string{}
+	for i := 0; i+1 < len(details); i += 2 {
+		if details[i+1] != "" {
+			set = append(set, details[i]+" "+details[i+1])
+		}
+	}
+
+	if len(set) == 0 {
+		return cloud + " " + account
+	}
+
+	return cloud + " " + account + " (" + strings.Join(set, ", ") + ")"
+}
+
+// firstVar returns the value of the first of the variables that is set.
+func firstVar(vars map[string]string, names ...string) string {
+	for _, name := range names {
+		if vars[name] != "" {
+			return vars[name]
+		}
+	}
+
+	return ""
+}
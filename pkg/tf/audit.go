@@ -0,0 +1,198 @@
+package tf
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AuditLog is the file, relative to the root, where every plan, apply and
+// destroy is recorded.
+const AuditLog = ".tf/audit.jsonl"
+
+// AuditedCommands are the commands recorded in the audit log: the terraform
+// commands, the drift checks (see DriftCommand) and the smoke tests (see
+// TestsCommand).
+var AuditedCommands = []string{"plan", "apply", "destroy", DriftCommand, TestsCommand}
+
+// AuditConfig says where the audit log is sent besides AuditLog.
+type AuditConfig struct {
+	// Webhook is a URL that receives every AuditEntry as JSON. Like the
+	// notifications, it can use environment variables.
+	Webhook string `yaml:"webhook"`
+}
+
+// AuditEntry is a line of the audit log. Fields are only ever added to it,
+// never removed or renamed.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Component string    `json:"component"`
+	Workspace string    `json:"workspace,omitempty"`
+	User      string    `json:"user"`
+	Host      string    `json:"host"`
+	Command   string    `json:"command"`
+	Args      []string  `json:"args"`
+	ExitCode  int       `json:"exit_code"`
+	Duration  float64   `json:"duration"`
+
+	// Changes are the number of resources added, changed and destroyed,
+	// when terraform printed them.
+	Changes *ChangeCounts `json:"changes,omitempty"`
+
+	// Tests are only set for TestsCommand.
+	Tests []TestResult `json:"tests,omitempty"`
+}
+
+// Failed returns true if the command of the entry failed. A drift check that
+// found a drift exited with 2, but it did not fail.
+func (e AuditEntry) Failed() bool {
+	if e.Command == DriftCommand {
+		return e.ExitCode != 0 && e.ExitCode != 2
+	}
+
+	return e.ExitCode != 0
+}
+
+// IsAudited returns true if the terraform command with these arguments is
+// recorded in the audit log.
+func IsAudited(args []string) bool {
+	for _, command := range AuditedCommands {
+		if len(args) > 0 && args[0] == command {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewAuditEntry returns the entry of the terraform command run in the
+// component, which finished with err. The values of the variables passed
+// with -var are not recorded, since they can be secrets.
+func NewAuditEntry(component string, args []string, err error, duration time.Duration) AuditEntry {
+	entry := AuditEntry{
+		Time:      time.Now().UTC(),
+		Component: component,
+		User:      currentUser(),
+		Command:   args[0],
+		Args:      redactVars(args[1:]),
+		Duration:  duration.Seconds(),
+	}
+	entry.Host, _ = os.Hostname()
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		entry.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		entry.ExitCode = -1
+	}
+
+	return entry
+}
+
+func redactVars(args []string) []string {
+	redacted := make([]string, len(args))
+
+	for i, arg := range args {
+		if i > 0 && args[i-1] == "-var" {
+			arg = redactVar(arg)
+		} else if strings.HasPrefix(arg, "-var=") {
+			arg = "-var=" + redactVar(strings.TrimPrefix(arg, "-var="))
+		}
+		redacted[i] = arg
+	}
+
+	return redacted
+}
+
+func redactVar(arg string) string {
+	if i := strings.Index(arg, "="); i >= 0 {
+		return arg[:i] + "=***"
+	}
+
+	return arg
+}
+
+// WriteAuditEntry appends the entry to the audit log of the root. Every
+// entry is written at once, so that the lines of the commands that run at the
+// same time are not mixed.
+func WriteAuditEntry(root string, entry AuditEntry) error {
+	path := filepath.Join(root, filepath.FromSlash(AuditLog))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(body, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// ReadAuditLog returns the entries of the audit log of the root, oldest
+// first. It is empty if nothing was recorded yet.
+func ReadAuditLog(root string) ([]AuditEntry, error) {
+	file, err := os.Open(filepath.Join(root, filepath.FromSlash(AuditLog)))
+	if os.IsNotExist(err) {
+		return []AuditEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []AuditEntry{}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("line %d of %s is not valid: %w", line, AuditLog, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// audit records the terraform command in the audit log of the runner, and
+// sends it to its webhook. Failures are only reported in stderr, they never
+// stop the command.
+func (r *Runner) audit(entry AuditEntry) {
+	if r.AuditRoot == "" {
+		return
+	}
+
+	if err := WriteAuditEntry(r.AuditRoot, entry); err != nil {
+		fmt.Fprintf(r.Stderr, "Warning: could not write the audit log: %s\n", err)
+	}
+
+	if r.Audit.Webhook != "" {
+		body, err := json.Marshal(entry)
+		if err != nil {
+			fmt.Fprintf(r.Stderr, "Warning: could not encode the audit entry: %s\n", err)
+			return
+		}
+
+		r.postWebhook(os.ExpandEnv(r.Audit.Webhook), body)
+	}
+}
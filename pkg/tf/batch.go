@@ -0,0 +1,147 @@
+package tf
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// These are the results of a component in a multi-component run.
+const (
+	ResultOK      = "ok"
+	ResultFailed  = "failed"
+	ResultSkipped = "skipped"
+)
+
+// ErrCancelled is returned, wrapped, by the run of a component that the user
+// decided not to run, like an apply whose plan was not confirmed. The
+// component is skipped instead of failed.
+var ErrCancelled = errors.New("cancelled")
+
+// RunResult is the result of running a command on one of the components of a
+// multi-component run.
+type RunResult struct {
+	Component string
+	Result    string
+	Duration  time.Duration
+
+	// Err is why the component failed or was skipped.
+	Err error
+
+	// Changes are the changes of the plan of the component, if the command
+	// made one.
+	Changes *PlanSummary
+
+	// Tests are the results of the smoke tests run after the apply of the
+	// component.
+	Tests []TestResult
+}
+
+// RunInOrder calls run for every component, one after the other in the given
+// order. A component is skipped if any of its blockers (its dependencies
+// when applying, its dependents when destroying) failed or was skipped, or if
+// run returns ErrCancelled.
+func RunInOrder(order []string, blockers func(component string) []string, run func(component string) error) []RunResult {
+	return RunParallel(order, blockers, 1, run)
+}
+
+// RunParallel is like RunInOrder, but it runs up to jobs components at the
+// same time. A component is started once all its blockers are done, so the
+// order must have the blockers of every component before it. The blockers
+// that are not part of the order don't block anything. The results are in
+// the given order.
+func RunParallel(order []string, blockers func(component string) []string, jobs int, run func(component string) error) []RunResult {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	results := make([]RunResult, len(order))
+	inOrder := map[string]bool{}
+	for _, component := range order {
+		inOrder[component] = true
+	}
+
+	started := make([]bool, len(order))
+	done := map[string]bool{}
+	notOK := map[string]bool{}
+	finished := make(chan int)
+	running := 0
+
+	finish := func(i int) {
+		done[order[i]] = true
+		if results[i].Result != ResultOK {
+			notOK[order[i]] = true
+		}
+	}
+
+	// startReady starts the components whose blockers are done, skipping the
+	// ones whose blockers did not succeed, and returns true if it skipped
+	// any, since others can be skipped because of them.
+	startReady := func() bool {
+		skipped := false
+
+		for i, component := range order {
+			if started[i] || running >= jobs {
+				continue
+			}
+
+			ready := true
+			for _, blocker := range blockers(component) {
+				if notOK[blocker] {
+					results[i] = RunResult{Component: component, Result: ResultSkipped, Err: fmt.Errorf("'%s' did not succeed", blocker)}
+					break
+				}
+				if inOrder[blocker] && done[blocker] == false {
+					ready = false
+				}
+			}
+
+			if results[i].Result == ResultSkipped {
+				started[i] = true
+				finish(i)
+				skipped = true
+				continue
+			}
+			if ready == false {
+				continue
+			}
+
+			started[i] = true
+			running++
+
+			go func(i int, component string) {
+				result := RunResult{Component: component, Result: ResultOK}
+
+				start := time.Now()
+				result.Err = run(component)
+				result.Duration = time.Since(start)
+
+				if errors.Is(result.Err, ErrCancelled) {
+					result.Result = ResultSkipped
+				} else if result.Err != nil {
+					result.Result = ResultFailed
+				}
+
+				results[i] = result
+				finished <- i
+			}(i, component)
+		}
+
+		return skipped
+	}
+
+	for {
+		for startReady() {
+		}
+
+		if running == 0 {
+			break
+		}
+
+		i := <-finished
+		running--
+		finish(i)
+	}
+
+	return results
+}
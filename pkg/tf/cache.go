@@ -0,0 +1,124 @@
+package tf
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CacheFile is the file, relative to the root, where the components found in
+// the directories are cached.
+const CacheFile = ".tf/cache.json"
+
+// CacheComponents makes Config.FindComponents use FindAllComponentsCached
+// instead of FindAllComponents.
+var CacheComponents = false
+
+// componentsCache is the content of CacheFile, by the absolute path of the
+// directories that were searched.
+type componentsCache map[string]cachedComponents
+
+type cachedComponents struct {
+	// Dirs are the modification times of all the directories that were
+	// walked. Creating, removing or renaming a file changes the time of its
+	// directory, so the components are the same as long as they don't
+	// change.
+	Dirs       map[string]time.Time `json:"dirs"`
+	Files      []string             `json:"files"`
+	Ignored    []string             `json:"ignored"`
+	MaxDepth   int                  `json:"max_depth"`
+	Symlinks   bool                 `json:"symlinks"`
+	Components []string             `json:"components"`
+}
+
+// FindAllComponentsCached is like FindAllComponentsWith, but it returns the
+// components found by the last call if none of the directories changed since
+// then, without walking them again. The results are cached in the CacheFile
+// of the root. Since only the directories are checked, changing the content
+// of a terragrunt.hcl (but not creating or removing it) is not noticed.
+func FindAllComponentsCached(root string, wd string, options WalkOptions) ([]string, error) {
+	path := filepath.Join(root, filepath.FromSlash(CacheFile))
+
+	dir, err := filepath.Abs(wd)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := componentsCache{}
+	if body, err := ioutil.ReadFile(path); err == nil {
+		// A broken cache is walked again and overwritten.
+		if json.Unmarshal(body, &cache) != nil {
+			cache = componentsCache{}
+		}
+	}
+
+	if cached, ok := cache[dir]; ok && cached.sameOptions(options) && cached.isFresh() {
+		Log(LogVerbose, "found components in the cache", "dir", dir, "components", len(cached.Components))
+		return cached.Components, nil
+	}
+
+	components, dirs, err := findAllComponents(dir, options)
+	if err != nil {
+		return components, err
+	}
+
+	cache[dir] = cachedComponents{Dirs: dirs, Files: options.ComponentFiles, Ignored: options.IgnoredDirs, MaxDepth: options.MaxDepth, Symlinks: options.FollowSymlinks, Components: components}
+	if err := writeCache(path, cache); err != nil {
+		Log(LogDebug, "could not write the cache", "file", path, "error", err)
+	}
+
+	return components, nil
+}
+
+// sameOptions returns true if the components were found with the same
+// component files, ignored directories, depth and symbolic links.
+func (c cachedComponents) sameOptions(options WalkOptions) bool {
+	return strings.Join(c.Files, "\n") == strings.Join(options.ComponentFiles, "\n") &&
+		strings.Join(c.Ignored, "\n") == strings.Join(options.IgnoredDirs, "\n") &&
+		c.MaxDepth == options.MaxDepth && c.Symlinks == options.FollowSymlinks
+}
+
+// isFresh returns true if none of the directories changed.
+func (c cachedComponents) isFresh() bool {
+	for dir, modTime := range c.Dirs {
+		stat, err := os.Stat(dir)
+		if err != nil || stat.ModTime().Equal(modTime) == false {
+			Log(LogDebug, "the cache is stale", "dir", dir)
+			return false
+		}
+	}
+
+	return len(c.Dirs) > 0
+}
+
+// writeCache writes the cache to a temporary file that replaces the cache
+// file at once, so that two invocations never read half of it.
+func writeCache(path string, cache componentsCache) error {
+	body, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), "cache-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,345 @@
+// Package tf contains the core logic of the tf utility: discovering the
+// components of a directory, reading their status and running terraform
+// inside them. The tf command is a thin wrapper around this package.
+package tf
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTooManyFiles      = errors.New("Too many files in this sub-directory")
+	ErrComponentNotFound = errors.New("Component not found")
+	ErrComponentNotDir   = errors.New("Component is not a folder")
+)
+
+// MaxFiles is the maximum number of files FindAllComponents is going to
+// walk before giving up with ErrTooManyFiles, unless tf.yaml says otherwise.
+const MaxFiles = 1_000
+
+// TerragruntFile is the file of the components managed by terragrunt.
+const TerragruntFile = "terragrunt.hcl"
+
+// TerragruntBinary is the binary run for the components managed by
+// terragrunt.
+const TerragruntBinary = "terragrunt"
+
+// FindAllComponents finds all the components in all the subfolders of the
+// directory passed as argument: the folders with a main.tf (or one of the
+// DefaultComponentFiles), and the ones with a terragrunt.hcl that has a
+// terraform block. If we are going to scan too many files we are
+// going to report an error, because it was probably not the intention of the
+// user to run this command on that directory (for example the root directory).
+// The directories in DefaultIgnoredDirs are not searched.
+func FindAllComponents(wd string) ([]string, error) {
+	return FindAllComponentsWith(wd, DefaultWalkOptions)
+}
+
+// DefaultIgnoredDirs are the directories that are not searched for
+// components, unless tf.yaml says otherwise: the folder of git, and the
+// folders of the modules, whose main.tf are not components.
+var DefaultIgnoredDirs = []string{".git", "modules"}
+
+// DefaultComponentFiles are the files that make a folder a component,
+// unless tf.yaml says otherwise.
+var DefaultComponentFiles = []string{"main.tf"}
+
+// WalkOptions say how the directories are walked to find the components.
+type WalkOptions struct {
+	// ComponentFiles are patterns (like "*.tf") of the names of the files
+	// that make a folder a component.
+	ComponentFiles []string
+
+	// IgnoredDirs are patterns (like "vendor*") of the names of the
+	// directories that are not searched.
+	IgnoredDirs []string
+
+	// MaxFiles is the number of files walked before giving up with
+	// ErrTooManyFiles, 0 for no limit.
+	MaxFiles int
+
+	// MaxDepth is how many levels of directories are searched, 0 for no
+	// limit. With 1 only the folders of the directory itself can be
+	// components.
+	MaxDepth int
+
+	// FollowSymlinks walks the directories the symbolic links point to, as
+	// if they were in the folder of the link.
+	FollowSymlinks bool
+}
+
+// DefaultWalkOptions are the WalkOptions of FindAllComponents.
+var DefaultWalkOptions = WalkOptions{ComponentFiles: DefaultComponentFiles, IgnoredDirs: DefaultIgnoredDirs, MaxFiles: MaxFiles}
+
+// FindAllComponentsWith is like FindAllComponents, but it walks the
+// directories following the options instead of the DefaultWalkOptions.
+func FindAllComponentsWith(wd string, options WalkOptions) ([]string, error) {
+	components, _, err := findAllComponents(wd, options)
+	return components, err
+}
+
+// findAllComponents is FindAllComponentsWith, that also returns the
+// modification time of every directory it walked.
+func findAllComponents(wd string, options WalkOptions) ([]string, map[string]time.Time, error) {
+	components := []string{}
+	found := map[string]bool{}
+	dirs := map[string]time.Time{}
+
+	numWalks := 0
+	start := time.Now()
+
+	err := walk(wd, options.FollowSymlinks, nil, func(path string, info os.FileInfo, err error) error {
+		numWalks += 1
+		if options.MaxFiles > 0 && numWalks > options.MaxFiles {
+			return ErrTooManyFiles
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			Log(LogDebug, "walking directory", "dir", path)
+			dirs[path] = info.ModTime()
+		}
+
+		// The caches of terraform and terragrunt have copies of the
+		// modules, which are not components, and the folder of tf only
+		// has its own files (which change on every run).
+		if info.IsDir() && (info.Name() == ".terraform" || info.Name() == ".terragrunt-cache" || info.Name() == ".tf") {
+			delete(dirs, path)
+			return filepath.SkipDir
+		}
+		if info.IsDir() && path != wd && isIgnoredDir(info.Name(), options.IgnoredDirs) {
+			Log(LogDebug, "ignoring directory", "dir", path)
+			delete(dirs, path)
+			return filepath.SkipDir
+		}
+		if info.IsDir() && options.MaxDepth > 0 && depth(wd, path) > options.MaxDepth {
+			delete(dirs, path)
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+		if isComponentFile(info.Name(), options.ComponentFiles) == false && (info.Name() != TerragruntFile || isTerragruntComponent(path) == false) {
+			return nil
+		}
+
+		// The component name should be the relative path between the
+		// working directory and the folder of the file, always with
+		// forward slashes so that it is the same on every platform.
+		component, err := filepath.Rel(wd, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		component = filepath.ToSlash(component)
+
+		// A folder can have many component files and a terragrunt.hcl.
+		if found[component] == false {
+			found[component] = true
+			components = append(components, component)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return []string{}, nil, err
+	}
+
+	Log(LogVerbose, "found components", "dir", wd, "components", len(components), "files", numWalks, "duration", time.Since(start))
+
+	return components, dirs, nil
+}
+
+// walk is filepath.Walk, but with followSymlinks it also walks the
+// directories the symbolic links point to, with the paths of the link. The
+// links to a directory that is already being walked (like "shared -> ..")
+// are skipped, since they would be walked forever. walking are the real
+// paths of the directories whose links are being walked.
+func walk(dir string, followSymlinks bool, walking []string, walkFn filepath.WalkFunc) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || followSymlinks == false || info.Mode()&os.ModeSymlink == 0 {
+			return walkFn(path, info, err)
+		}
+
+		// Broken links, and the ones to files, are walked like before.
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			Log(LogDebug, "ignoring broken symbolic link", "link", path, "error", err)
+			return walkFn(path, info, nil)
+		}
+		targetInfo, err := os.Stat(target)
+		if err != nil || targetInfo.IsDir() == false {
+			return walkFn(path, info, nil)
+		}
+
+		target, err = filepath.Abs(target)
+		if err != nil {
+			return err
+		}
+		parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		parent, err = filepath.Abs(parent)
+		if err != nil {
+			return err
+		}
+		for _, dir := range append(walking, parent) {
+			if dir == target || strings.HasPrefix(dir, target+string(filepath.Separator)) {
+				Log(LogDebug, "ignoring symbolic link loop", "link", path, "target", target)
+				return nil
+			}
+		}
+
+		// The link is walked as a directory, that can be skipped.
+		err = walkFn(path, targetInfo, nil)
+		if err == filepath.SkipDir {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		Log(LogDebug, "following symbolic link", "link", path, "target", target)
+		return walk(target, true, append(walking, target), func(p string, info os.FileInfo, err error) error {
+			if p == target {
+				return nil
+			}
+
+			return walkFn(path+strings.TrimPrefix(p, target), info, err)
+		})
+	})
+}
+
+// depth returns how many levels of directories dir is below wd.
+func depth(wd string, dir string) int {
+	rel, err := filepath.Rel(wd, dir)
+	if err != nil || rel == "." {
+		return 0
+	}
+
+	return len(strings.Split(filepath.ToSlash(rel), "/"))
+}
+
+func isComponentFile(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isIgnoredDir(name string, ignored []string) bool {
+	for _, pattern := range ignored {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NormalizeComponent returns the name of the component passed as argument
+// in the same form FindAllComponents uses, so that "./rds-mysql/",
+// "rds-mysql" and (on Windows) "dev-machines\\ubuntu" all refer to the
+// same component as it is shown in the status.
+func NormalizeComponent(component string) string {
+	return filepath.ToSlash(filepath.Clean(component))
+}
+
+// CheckComponent returns an error if the component does not exist or if it
+// is not a folder.
+func CheckComponent(component string) error {
+	stat, err := os.Stat(component)
+	if os.IsNotExist(err) {
+		return ErrComponentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if stat.IsDir() == false {
+		return ErrComponentNotDir
+	}
+
+	return nil
+}
+
+// IsPattern returns true if the argument is a pattern that selects multiple
+// components, like "network/*" or "envs/prod/**", instead of a component.
+func IsPattern(arg string) bool {
+	return strings.ContainsAny(arg, "*?[")
+}
+
+// MatchComponents returns the components whose name matches the pattern.
+// Every "/" separated part of the pattern is matched like with path.Match,
+// and a "**" part matches any number of directories (including none).
+func MatchComponents(pattern string, components []string) ([]string, error) {
+	parts := strings.Split(NormalizeComponent(pattern), "/")
+
+	for _, part := range parts {
+		if _, err := path.Match(part, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+
+	matched := []string{}
+	for _, component := range components {
+		if matchParts(parts, strings.Split(component, "/")) {
+			matched = append(matched, component)
+		}
+	}
+
+	return matched, nil
+}
+
+// matchParts matches the parts of a pattern with the parts of a name.
+func matchParts(pattern []string, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchParts(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+
+	ok, _ := path.Match(pattern[0], name[0])
+	return ok && matchParts(pattern[1:], name[1:])
+}
+
+// IsTerragrunt returns true if the component is managed by terragrunt.
+func IsTerragrunt(component string) bool {
+	return isTerragruntComponent(filepath.Join(component, TerragruntFile))
+}
+
+// isTerragruntComponent returns true if the terragrunt.hcl has a terraform
+// block. The ones without it, like the root terragrunt.hcl included by the
+// others, only have shared settings.
+func isTerragruntComponent(path string) bool {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	return len(FindBlocks(stripComments(string(body)), "terraform")) > 0
+}
@@ -0,0 +1,133 @@
+package tf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+func TestNormalizeComponent(t *testing.T) {
+	tests := []struct {
+		component string
+		want      string
+	}{
+		{"rds-mysql", "rds-mysql"},
+		{"./rds-mysql/", "rds-mysql"},
+		{"./dev-machines/ubuntu", "dev-machines/ubuntu"},
+		{"dev-machines//ubuntu/", "dev-machines/ubuntu"},
+		{"dev-machines/../rds-mysql", "rds-mysql"},
+		{filepath.Join("dev-machines", "ubuntu"), "dev-machines/ubuntu"},
+		{".", "."},
+		{"./", "."},
+	}
+
+	// The backslashes are separators only on Windows.
+	if runtime.GOOS == "windows" {
+		tests = append(tests, []struct {
+			component string
+			want      string
+		}{
+			{`dev-machines\ubuntu`, "dev-machines/ubuntu"},
+			{`.\dev-machines\ubuntu\`, "dev-machines/ubuntu"},
+		}...)
+	}
+
+	for _, test := range tests {
+		if got := NormalizeComponent(test.component); got != test.want {
+			t.Errorf("NormalizeComponent(%q) = %q, want %q", test.component, got, test.want)
+		}
+	}
+}
+
+func TestMatchComponents(t *testing.T) {
+	components := []string{"network", "dev-machines/ubuntu", "dev-machines/debian", "envs/prod/db", "envs/prod/eu/app", "envs/dev/db"}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"dev-machines/*", []string{"dev-machines/ubuntu", "dev-machines/debian"}},
+		{"./dev-machines/*", []string{"dev-machines/ubuntu", "dev-machines/debian"}},
+		{"dev-machines/*/", []string{"dev-machines/ubuntu", "dev-machines/debian"}},
+		{"envs/prod/**", []string{"envs/prod/db", "envs/prod/eu/app"}},
+		{"**/db", []string{"envs/prod/db", "envs/dev/db"}},
+		{"envs/*/db", []string{"envs/prod/db", "envs/dev/db"}},
+		{"net*", []string{"network"}},
+		{"nothing/*", []string{}},
+	}
+
+	if runtime.GOOS == "windows" {
+		tests = append(tests, []struct {
+			pattern string
+			want    []string
+		}{
+			{`dev-machines\*`, []string{"dev-machines/ubuntu", "dev-machines/debian"}},
+			{`.\envs\prod\**`, []string{"envs/prod/db", "envs/prod/eu/app"}},
+		}...)
+	}
+
+	for _, test := range tests {
+		got, err := MatchComponents(test.pattern, components)
+		if err != nil {
+			t.Errorf("MatchComponents(%q) failed: %s", test.pattern, err)
+			continue
+		}
+		if reflect.DeepEqual(got, test.want) == false {
+			t.Errorf("MatchComponents(%q) = %q, want %q", test.pattern, got, test.want)
+		}
+	}
+
+	if _, err := MatchComponents("dev-machines/[", components); err == nil {
+		t.Errorf("MatchComponents of an invalid pattern should fail")
+	}
+}
+
+func TestFindAllComponents(t *testing.T) {
+	root := t.TempDir()
+
+	files := []string{
+		"main.tf",
+		"network/main.tf",
+		"dev-machines/ubuntu/main.tf",
+		"dev-machines/ubuntu/variables.tf",
+		"envs/prod/db/main.tf",
+		"modules/vpc/main.tf",
+		"network/.terraform/modules/vpc/main.tf",
+		"docs/README.md",
+	}
+	for _, file := range files {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := FindAllComponents(root)
+	if err != nil {
+		t.Fatalf("FindAllComponents failed: %s", err)
+	}
+	sort.Strings(got)
+
+	// The names use forward slashes on every platform, and the working
+	// directory itself is ".".
+	want := []string{".", "dev-machines/ubuntu", "envs/prod/db", "network"}
+	if reflect.DeepEqual(got, want) == false {
+		t.Errorf("FindAllComponents = %q, want %q", got, want)
+	}
+
+	// The names given as arguments, with any separator, are the same
+	// components.
+	for _, component := range want {
+		argument := "." + string(filepath.Separator) + filepath.FromSlash(component) + string(filepath.Separator)
+		if normalized := NormalizeComponent(argument); normalized != component {
+			t.Errorf("NormalizeComponent(%q) = %q, want %q", argument, normalized, component)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package tf
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile is the name of the optional project configuration file, which
+// is read from the directory tf is run from.
+const ConfigFile = "tf.yaml"
+
+// IgnoreFile is the name of the optional file, next to the ConfigFile, with
+// the patterns of the components that are ignored, one per line, like a
+// .gitignore.
+const IgnoreFile = ".tfignore"
+
+// Config is the project configuration.
+type Config struct {
+	// Roots are the directories where the components are searched, relative
+	// to the directory of the config. By default it is the directory itself.
+	Roots []string `yaml:"roots"`
+
+	// Exclude are patterns (like "legacy/*") of the components that are
+	// ignored, like the ones of .gitignore, see Excluded. A pattern matching
+	// a directory excludes everything inside it.
+	Exclude []string `yaml:"exclude"`
+
+	// ComponentFiles are patterns (like "*.tf") of the names of the files
+	// that make a folder a component. By default they are the
+	// DefaultComponentFiles.
+	ComponentFiles []string `yaml:"component_files"`
+
+	// IgnoredDirs are patterns (like "vendor*") of the names of the
+	// directories that are not searched for components. By default they
+	// are the DefaultIgnoredDirs.
+	IgnoredDirs []string `yaml:"ignored_dirs"`
+
+	// MaxFiles is the number of files walked to find the components before
+	// giving up, 0 for no limit. By default it is MaxFiles.
+	MaxFiles *int `yaml:"max_files"`
+
+	// MaxDepth is how many levels of directories are searched for
+	// components, 0 (the default) for no limit.
+	MaxDepth int `yaml:"max_depth"`
+
+	// FollowSymlinks searches the components in the directories that the
+	// symbolic links point to, which are not searched by default.
+	FollowSymlinks bool `yaml:"follow_symlinks"`
+
+	// Binary is the binary tf runs, like "tofu" to use OpenTofu. By default
+	// it is the one found by DetectBinary.
+	Binary string `yaml:"binary"`
+
+	// DownloadTerraform downloads the terraform version required by a
+	// component when it is not installed.
+	DownloadTerraform bool `yaml:"download_terraform"`
+
+	// Flags are the default flags of every command, by command name. They
+	// are passed before the ones in the command line, which win over them.
+	Flags map[string][]string `yaml:"flags"`
+
+	// Notifications are the webhooks notified when the components are
+	// applied.
+	Notifications NotificationsConfig `yaml:"notifications"`
+
+	// Audit says where else the audit log is sent.
+	Audit AuditConfig `yaml:"audit"`
+
+	// Locks says where the components are locked besides the local files.
+	Locks LocksConfig `yaml:"locks"`
+
+	// Components has the settings of the components, by name.
+	Components map[string]ComponentConfig `yaml:"components"`
+}
+
+// ComponentConfig has the settings of a component in the project config.
+type ComponentConfig struct {
+	// DependsOn are the components that have to be applied before this one,
+	// and destroyed after it.
+	DependsOn []string `yaml:"depends_on"`
+
+	// Binary is the terraform executable used for this component instead of
+	// the default one, for example to pin an older version.
+	Binary string `yaml:"binary"`
+
+	// Env are the environment variables added to the terraform commands run
+	// inside the component.
+	Env map[string]string `yaml:"env"`
+
+	// Vars are the default values of the variables of the component.
+	Vars map[string]string `yaml:"vars"`
+
+	// VarFiles are the default variable files of the component, relative to
+	// its directory.
+	VarFiles []string `yaml:"var_files"`
+
+	// Environments are the environments (like dev, staging and prod) that
+	// the component manages, each one in its own terraform workspace.
+	Environments []string `yaml:"environments"`
+
+	// AutoApprove applies the component without asking for confirmation,
+	// like --yes, for the components where it is safe (like sandboxes).
+	AutoApprove bool `yaml:"auto_approve"`
+}
+
+// Workspaces returns the workspaces of the component: one for each of its
+// environments, or just the default one.
+func (c ComponentConfig) Workspaces() []string {
+	if len(c.Environments) == 0 {
+		return []string{DefaultWorkspace}
+	}
+
+	return c.Environments
+}
+
+// HasEnvironments returns true if any of the components has environments.
+func (c Config) HasEnvironments() bool {
+	for _, component := range c.Components {
+		if len(component.Environments) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// VarArgs returns the -var and -var-file arguments for the default variables
+// of the component, sorted so that the command is always the same.
+func (c ComponentConfig) VarArgs() []string {
+	args := []string{}
+
+	for _, file := range c.VarFiles {
+		args = append(args, "-var-file", file)
+	}
+
+	names := []string{}
+	for name := range c.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		args = append(args, "-var", name+"="+c.Vars[name])
+	}
+
+	return args
+}
+
+// LoadConfig reads the tf.yaml of the root, returning an empty config if
+// there is none. The patterns of the .tfignore of the root are added before
+// the exclude of tf.yaml, so that the ones of tf.yaml win.
+func LoadConfig(root string) (Config, error) {
+	config := Config{Components: map[string]ComponentConfig{}}
+
+	ignored, err := ReadIgnoreFile(root)
+	if err != nil {
+		return config, err
+	}
+
+	f, err := os.Open(filepath.Join(root, ConfigFile))
+	if os.IsNotExist(err) {
+		config.Exclude = ignored
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(&config)
+	if err != nil && err != io.EOF {
+		return config, fmt.Errorf("could not read %s: %w", ConfigFile, err)
+	}
+
+	for i, root := range config.Roots {
+		config.Roots[i] = NormalizeComponent(root)
+	}
+	for _, pattern := range config.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return config, fmt.Errorf("invalid pattern '%s' in the exclude of %s: %w", pattern, ConfigFile, err)
+		}
+	}
+	config.Exclude = append(ignored, config.Exclude...)
+	if config.MaxFiles != nil && *config.MaxFiles < 0 {
+		return config, fmt.Errorf("the max_files of %s can't be negative", ConfigFile)
+	}
+	if config.MaxDepth < 0 {
+		return config, fmt.Errorf("the max_depth of %s can't be negative", ConfigFile)
+	}
+	for _, pattern := range config.ComponentFiles {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return config, fmt.Errorf("invalid pattern '%s' in the component_files of %s: %w", pattern, ConfigFile, err)
+		}
+	}
+	for _, pattern := range config.IgnoredDirs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return config, fmt.Errorf("invalid pattern '%s' in the ignored_dirs of %s: %w", pattern, ConfigFile, err)
+		}
+	}
+
+	if config.Components == nil {
+		config.Components = map[string]ComponentConfig{}
+	}
+
+	// The names are normalized so that "./network/" matches the component
+	// "network" found by FindAllComponents.
+	components := map[string]ComponentConfig{}
+	for name, component := range config.Components {
+		for i, dependency := range component.DependsOn {
+			component.DependsOn[i] = NormalizeComponent(dependency)
+		}
+		components[NormalizeComponent(name)] = component
+	}
+	config.Components = components
+
+	Log(LogDebug, "read the config", "file", filepath.Join(root, ConfigFile), "components", len(config.Components))
+
+	return config, nil
+}
+
+// ReadIgnoreFile returns the patterns of the .tfignore of the root, which
+// has the syntax of a .gitignore: one pattern per line, with the empty lines
+// and the ones that start with "#" ignored. It is empty if there is no
+// .tfignore.
+func ReadIgnoreFile(root string) ([]string, error) {
+	body, err := ioutil.ReadFile(filepath.Join(root, IgnoreFile))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := []string{}
+	for i, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s' in line %d of %s: %w", line, i+1, IgnoreFile, err)
+		}
+		patterns = append(patterns, line)
+	}
+
+	return patterns, nil
+}
+
+// Excluded returns true if the component is excluded by the exclude
+// patterns, which work like the ones of .gitignore: a pattern excludes the
+// components whose path, or the path of one of the directories that contain
+// them, matches it. A pattern without "/" (like "examples") matches a name at
+// any depth, the others (like "aws/legacy" or "/examples") match the path
+// from the root, "**" matches any number of directories, and a pattern that
+// starts with "!" includes again what the previous ones excluded.
+func (c Config) Excluded(component string) bool {
+	excluded := false
+
+	for _, pattern := range c.Exclude {
+		negated := strings.HasPrefix(pattern, "!")
+		if matchExclude(strings.TrimPrefix(pattern, "!"), component) {
+			excluded = negated == false
+		}
+	}
+
+	return excluded
+}
+
+func matchExclude(pattern string, component string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if strings.HasPrefix(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else if strings.Contains(pattern, "/") == false {
+		pattern = "**/" + pattern
+	}
+	parts := strings.Split(NormalizeComponent(pattern), "/")
+
+	for dir := component; dir != "."; dir = path.Dir(dir) {
+		if matchParts(parts, strings.Split(dir, "/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WalkOptions returns the options of the walk of the roots of the config.
+func (c Config) WalkOptions() WalkOptions {
+	options := DefaultWalkOptions
+	if c.ComponentFiles != nil {
+		options.ComponentFiles = c.ComponentFiles
+	}
+	if c.IgnoredDirs != nil {
+		options.IgnoredDirs = c.IgnoredDirs
+	}
+	if c.MaxFiles != nil {
+		options.MaxFiles = *c.MaxFiles
+	}
+	options.MaxDepth = c.MaxDepth
+	options.FollowSymlinks = c.FollowSymlinks
+
+	return options
+}
+
+// FindComponents finds the components in the roots of the config that are
+// not excluded, with their names relative to wd.
+func (c Config) FindComponents(wd string) ([]string, error) {
+	roots := c.Roots
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	options := c.WalkOptions()
+
+	found := map[string]bool{}
+	components := []string{}
+
+	for _, root := range roots {
+		var inRoot []string
+		var err error
+		if CacheComponents {
+			inRoot, err = FindAllComponentsCached(wd, filepath.Join(wd, filepath.FromSlash(root)), options)
+		} else {
+			inRoot, err = FindAllComponentsWith(filepath.Join(wd, filepath.FromSlash(root)), options)
+		}
+		if err == ErrTooManyFiles {
+			return []string{}, err
+		}
+		if err != nil {
+			return []string{}, fmt.Errorf("could not search the root '%s': %w", root, err)
+		}
+
+		for _, component := range inRoot {
+			component = NormalizeComponent(path.Join(root, component))
+
+			if found[component] || c.Excluded(component) {
+				continue
+			}
+			found[component] = true
+			components = append(components, component)
+		}
+	}
+
+	// A single root keeps the order of FindAllComponents.
+	if len(roots) > 1 {
+		sort.Strings(components)
+	}
+
+	return components, nil
+}
+
+// FindProjectComponents loads the config of the directory and returns the
+// components found following it.
+func FindProjectComponents(wd string) ([]string, error) {
+	config, err := LoadConfig(wd)
+	if err != nil {
+		return []string{}, err
+	}
+
+	return config.FindComponents(wd)
+}
@@ -0,0 +1,49 @@
+package tf
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// consulTimeout is how long a request to Consul can take.
+const consulTimeout = 10 * time.Second
+
+// consulKVURL returns the URL of the Consul KV key, using the address in
+// CONSUL_HTTP_ADDR (the local agent by default).
+func consulKVURL(key string) string {
+	address := os.Getenv("CONSUL_HTTP_ADDR")
+	if address == "" {
+		address = "127.0.0.1:8500"
+	}
+	if strings.Contains(address, "://") == false {
+		address = "http://" + address
+	}
+
+	// The names of the outputs and of the components become path segments
+	// of the URL.
+	segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return strings.TrimSuffix(address, "/") + "/v1/kv/" + strings.Join(segments, "/")
+}
+
+// consulRequest sends a request to Consul, with the token in
+// CONSUL_HTTP_TOKEN.
+func consulRequest(method string, kvURL string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, kvURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("CONSUL_HTTP_TOKEN"); token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	client := http.Client{Timeout: consulTimeout}
+	return client.Do(req)
+}
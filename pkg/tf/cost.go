@@ -0,0 +1,89 @@
+package tf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// InfracostBinary is the executable of Infracost, which estimates the cost
+// of the plans.
+const InfracostBinary = "infracost"
+
+// Cost is the monthly cost of a component before and after a plan, as
+// estimated by Infracost.
+type Cost struct {
+	Past     float64
+	Total    float64
+	Currency string
+}
+
+// Diff returns how much the monthly cost changes with the plan.
+func (c Cost) Diff() float64 {
+	return c.Total - c.Past
+}
+
+// EstimateCost estimates the monthly cost of the component before and after
+// the plan saved in planFile, passing the JSON of the plan to "infracost
+// diff". In dry-run mode the cost is zero.
+func (r *Runner) EstimateCost(component string, planFile string) (Cost, error) {
+	jsonFile, err := r.WritePlanJSON(component, planFile)
+	if err != nil {
+		return Cost{}, err
+	}
+	defer os.Remove(jsonFile)
+
+	args := []string{"diff", "--path", jsonFile, "--format", "json", "--no-color"}
+	r.echoCommand(FormatCommand(InfracostBinary, args))
+	if r.DryRun {
+		return Cost{}, nil
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command(InfracostBinary, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = r.Stderr
+	if err := cmd.Run(); err != nil {
+		return Cost{}, fmt.Errorf("infracost failed: %w", err)
+	}
+
+	return parseInfracost(out.Bytes())
+}
+
+func parseInfracost(body []byte) (Cost, error) {
+	// The costs are decimal strings, or null when there is nothing with a
+	// cost.
+	var report struct {
+		Currency             string  `json:"currency"`
+		TotalMonthlyCost     *string `json:"totalMonthlyCost"`
+		PastTotalMonthlyCost *string `json:"pastTotalMonthlyCost"`
+	}
+	if err := json.Unmarshal(body, &report); err != nil {
+		return Cost{}, fmt.Errorf("could not unmarshal the output of infracost: %w", err)
+	}
+
+	cost := Cost{Currency: report.Currency}
+
+	for _, field := range []struct {
+		value *string
+		cost  *float64
+	}{
+		{report.TotalMonthlyCost, &cost.Total},
+		{report.PastTotalMonthlyCost, &cost.Past},
+	} {
+		if field.value == nil {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(*field.value, 64)
+		if err != nil {
+			return Cost{}, fmt.Errorf("invalid cost '%s' in the output of infracost", *field.value)
+		}
+		*field.cost = value
+	}
+
+	return cost, nil
+}
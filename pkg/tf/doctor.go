@@ -0,0 +1,168 @@
+package tf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	CheckPass = "pass"
+	CheckFail = "fail"
+	CheckSkip = "skip"
+)
+
+// Check is the result of one of the diagnostics run by Diagnose.
+type Check struct {
+	Name    string
+	Result  string
+	Message string
+
+	// Hint tells the user how to fix a failed check.
+	Hint string
+}
+
+// Diagnose checks that the environment has everything tf needs to work on
+// the components of the directory, returning the result of every check.
+func Diagnose(wd string, binary string) []Check {
+	return []Check{
+		checkBinary(binary),
+		checkGit(),
+		checkPluginCache(),
+		checkAWSCredentials(),
+		checkComponents(wd),
+	}
+}
+
+func checkBinary(binary string) Check {
+	check := Check{Name: binary}
+
+	if _, err := exec.LookPath(binary); err != nil {
+		check.Result = CheckFail
+		check.Message = "not found in the PATH"
+		check.Hint = fmt.Sprintf("install %s and make sure it is in the PATH", binary)
+		return check
+	}
+
+	out, err := exec.Command(binary, "version").Output()
+	if err != nil {
+		check.Result = CheckFail
+		check.Message = fmt.Sprintf("'%s version' failed: %s", binary, err)
+		check.Hint = fmt.Sprintf("make sure '%s version' works from this directory", binary)
+		return check
+	}
+
+	check.Result = CheckPass
+	check.Message = strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)[0]
+	return check
+}
+
+func checkGit() Check {
+	check := Check{Name: "git"}
+
+	path, err := exec.LookPath("git")
+	if err != nil {
+		check.Result = CheckFail
+		check.Message = "not found in the PATH"
+		check.Hint = "install git, terraform needs it to download modules from git repositories"
+		return check
+	}
+
+	check.Result = CheckPass
+	check.Message = path
+	return check
+}
+
+func checkPluginCache() Check {
+	check := Check{Name: "plugin cache"}
+
+	dir := os.Getenv("TF_PLUGIN_CACHE_DIR")
+	if dir == "" {
+		check.Result = CheckSkip
+		check.Message = "TF_PLUGIN_CACHE_DIR is not set"
+		return check
+	}
+
+	stat, err := os.Stat(dir)
+	if err != nil || stat.IsDir() == false {
+		check.Result = CheckFail
+		check.Message = fmt.Sprintf("'%s' is not a folder", dir)
+		check.Hint = fmt.Sprintf("create it with 'mkdir -p %s', terraform doesn't create it", dir)
+		return check
+	}
+
+	f, err := ioutil.TempFile(dir, ".tf-doctor")
+	if err != nil {
+		check.Result = CheckFail
+		check.Message = fmt.Sprintf("'%s' is not writable", dir)
+		check.Hint = fmt.Sprintf("fix the permissions of '%s'", dir)
+		return check
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	check.Result = CheckPass
+	check.Message = dir
+	return check
+}
+
+func checkAWSCredentials() Check {
+	check := Check{Name: "aws credentials"}
+
+	if _, err := exec.LookPath("aws"); err != nil {
+		check.Result = CheckSkip
+		check.Message = "the aws CLI is not installed"
+		return check
+	}
+
+	out, err := exec.Command("aws", "sts", "get-caller-identity", "--query", "Arn", "--output", "text").Output()
+	if err != nil {
+		check.Result = CheckFail
+		check.Message = "'aws sts get-caller-identity' failed"
+		check.Hint = "log in again (for example with 'aws sso login') or check AWS_PROFILE"
+		return check
+	}
+
+	check.Result = CheckPass
+	check.Message = strings.TrimSpace(string(out))
+	return check
+}
+
+func checkComponents(wd string) Check {
+	check := Check{Name: "components"}
+
+	config, err := LoadConfig(wd)
+	if err != nil {
+		check.Result = CheckFail
+		check.Message = err.Error()
+		return check
+	}
+
+	components, err := config.FindComponents(wd)
+	if err == ErrTooManyFiles {
+		check.Result = CheckFail
+		check.Message = fmt.Sprintf("more than %d files in the subdirectories", config.WalkOptions().MaxFiles)
+		check.Hint = "run tf from the directory that contains your components, or set the roots or raise max_files in " + ConfigFile
+		return check
+	}
+	if err != nil {
+		check.Result = CheckFail
+		check.Message = err.Error()
+		return check
+	}
+
+	for _, component := range components {
+		if _, err := GetStatus(component); err != nil {
+			check.Result = CheckFail
+			check.Message = err.Error()
+			check.Hint = fmt.Sprintf("check the terraform.tfstate of '%s'", component)
+			return check
+		}
+	}
+
+	check.Result = CheckPass
+	check.Message = fmt.Sprintf("%d components found", len(components))
+	return check
+}
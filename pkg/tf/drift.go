@@ -0,0 +1,35 @@
+package tf
+
+import (
+	"os/exec"
+)
+
+// DriftCommand is the command of the drift checks in the audit log. They are
+// refresh-only plans, but they don't change anything and finding a drift is
+// not a failure.
+const DriftCommand = "drift"
+
+// DetectDrift runs a refresh-only plan in the component and returns true if
+// the real infrastructure has drifted from its state. In dry-run mode it
+// never reports a drift.
+func (r *Runner) DetectDrift(component string, args ...string) (bool, error) {
+	driftArgs := append([]string{"plan", "-refresh-only", "-detailed-exitcode", "-input=false", "-lock=false"}, args...)
+
+	err := r.run(component, DriftCommand, driftArgs)
+	if isDrift(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// isDrift returns true if err is the exit of a plan with -detailed-exitcode
+// that has changes: terraform exits with 2 when there are changes, and with 1
+// when the plan failed.
+func isDrift(err error) bool {
+	exitErr, ok := err.(*exec.ExitError)
+	return ok && exitErr.ExitCode() == 2
+}
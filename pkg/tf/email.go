@@ -0,0 +1,127 @@
+package tf
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// SMTPConfig is the server that sends the emails of the notifications. The
+// username and the password can use environment variables, like the URLs of
+// the webhooks.
+type SMTPConfig struct {
+	// Address is the host and the port of the server, like
+	// smtp.example.com:587.
+	Address  string `yaml:"address"`
+	From     string `yaml:"from"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// smtpTimeout is how long sending an email can take, so that a server that
+// doesn't answer doesn't block the apply.
+const smtpTimeout = 30 * time.Second
+
+// sendEmail emails the notification to the addresses. A failure is only a
+// warning, like with the webhooks.
+func (r *Runner) sendEmail(config SMTPConfig, to []string, notification Notification) {
+	r.echoCommand("SMTP " + config.Address + " to " + strings.Join(to, ", "))
+	if r.DryRun {
+		return
+	}
+
+	if config.Address == "" || config.From == "" {
+		fmt.Fprintf(r.Stderr, "Warning: could not email %s: the notifications have no smtp address and from\n", strings.Join(to, ", "))
+		return
+	}
+
+	if err := sendMail(config, to, emailMessage(config.From, to, notification)); err != nil {
+		fmt.Fprintf(r.Stderr, "Warning: could not email %s: %s\n", strings.Join(to, ", "), err)
+	}
+}
+
+// emailMessage returns the email of the notification, with the text of the
+// Slack message as subject.
+func emailMessage(from string, to []string, notification Notification) []byte {
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s\r\n\r\n", notification.Text())
+	fmt.Fprintf(&body, "Component: %s\r\n", notification.Component)
+	fmt.Fprintf(&body, "Owner: %s\r\n", notification.Owner)
+	fmt.Fprintf(&body, "By: %s@%s\r\n", notification.User, notification.Host)
+	fmt.Fprintf(&body, "Time: %s\r\n", notification.Time.Format(time.RFC3339))
+	if notification.Changes != nil {
+		fmt.Fprintf(&body, "Changes: %s\r\n", notification.Changes)
+	}
+	if notification.Error != "" {
+		fmt.Fprintf(&body, "Error: %s\r\n", notification.Error)
+	}
+
+	// The text has no line breaks, but the error could.
+	subject := strings.Join(strings.Fields("[tf] "+notification.Text()), " ")
+
+	return []byte("From: " + from + "\r\n" +
+		"To: " + strings.Join(to, ", ") + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + body.String())
+}
+
+// sendMail sends the message like smtp.SendMail, but with a timeout.
+func sendMail(config SMTPConfig, to []string, message []byte) error {
+	conn, err := net.DialTimeout("tcp", config.Address, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	host, _, err := net.SplitHostPort(config.Address)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if config.Username != "" {
+		auth := smtp.PlainAuth("", os.ExpandEnv(config.Username), os.ExpandEnv(config.Password), host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(config.From); err != nil {
+		return err
+	}
+	for _, address := range to {
+		if err := client.Rcpt(address); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
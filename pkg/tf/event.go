@@ -0,0 +1,65 @@
+package tf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+)
+
+// These are the types of the events that are sent to the event plugins. New
+// types can be added in the future, so the plugins should ignore the events
+// they don't know about.
+const (
+	EventRunStarted  = "run_started"
+	EventRunFinished = "run_finished"
+
+	// EventTestsFinished is sent after the smoke tests of a component.
+	EventTestsFinished = "tests_finished"
+)
+
+// Event is the JSON document that is written to the standard input of the
+// event plugins. Fields are only ever added to it, never removed or renamed.
+type Event struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Component string    `json:"component"`
+	Args      []string  `json:"args"`
+
+	// Owner is the owner of the component from its component.yaml, so
+	// that the plugins can notify the right people.
+	Owner string `json:"owner,omitempty"`
+
+	// Success and Error are only set for EventRunFinished.
+	Success *bool  `json:"success,omitempty"`
+	Error   string `json:"error,omitempty"`
+
+	// Tests is only set for EventTestsFinished.
+	Tests []TestResult `json:"tests,omitempty"`
+}
+
+// SendEvent runs every plugin with the event in its standard input. Failing
+// plugins are reported in stderr, but they never stop the run.
+func SendEvent(plugins []string, event Event, stderr io.Writer) {
+	if len(plugins) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		fmt.Fprintf(stderr, "Warning: could not encode the '%s' event: %s\n", event.Type, err)
+		return
+	}
+
+	for _, plugin := range plugins {
+		cmd := exec.Command(plugin)
+		cmd.Stdin = bytes.NewReader(body)
+		cmd.Stderr = stderr
+
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(stderr, "Warning: event plugin '%s' failed: %s\n", plugin, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package tf
+
+import (
+	"errors"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+// LocalModules returns the folders of the modules that the component uses
+// from the same repository, the ones whose source starts with ./ or ../,
+// including the local modules of those modules. They are relative to where
+// tf is run, like the component.
+func LocalModules(component string) ([]string, error) {
+	modules := []string{}
+	seen := map[string]bool{component: true}
+	pending := []string{component}
+
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+
+		config, err := ReadConfig(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, block := range FindBlocks(config, "module") {
+			source := StringAttributes(block.Body)["source"]
+			if strings.HasPrefix(source, "./") == false && strings.HasPrefix(source, "../") == false {
+				continue
+			}
+
+			module := path.Clean(path.Join(dir, source))
+			if seen[module] {
+				continue
+			}
+			seen[module] = true
+
+			modules = append(modules, module)
+			pending = append(pending, module)
+		}
+	}
+
+	sort.Strings(modules)
+
+	return modules, nil
+}
+
+// Fmt runs "terraform fmt" in the folder, returning the files it formatted,
+// or the ones it would format with check, relative to where tf is run.
+func (r *Runner) Fmt(dir string, check bool) ([]string, error) {
+	args := []string{"fmt", "-list=true"}
+	if check {
+		args = append(args, "-check")
+	}
+
+	out, err := r.Output(dir, args...)
+
+	// With -check terraform exits with 3 when some files are not
+	// formatted.
+	var exitErr *exec.ExitError
+	if check && errors.As(err, &exitErr) && exitErr.ExitCode() == 3 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, file := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if file != "" {
+			files = append(files, path.Join(dir, strings.ReplaceAll(file, `\`, "/")))
+		}
+	}
+
+	return files, nil
+}
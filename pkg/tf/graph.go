@@ -0,0 +1,207 @@
+package tf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Graph is the dependency graph between the components.
+type Graph struct {
+	components   []string
+	dependencies map[string][]string
+}
+
+// NewGraph builds the dependency graph of the components from the
+// depends_on of the config, and the outputs their variables use. It returns
+// an error if a component depends on one that doesn't exist or if there is a
+// cycle.
+func NewGraph(components []string, config Config) (*Graph, error) {
+	g := &Graph{
+		components:   append([]string{}, components...),
+		dependencies: map[string][]string{},
+	}
+	sort.Strings(g.components)
+
+	exists := map[string]bool{}
+	for _, component := range components {
+		exists[component] = true
+	}
+
+	for _, component := range g.components {
+		dependencies := config.Components[component].Dependencies()
+
+		for _, dependency := range dependencies {
+			if exists[dependency] == false {
+				return nil, fmt.Errorf("component '%s' depends on '%s', which doesn't exist", component, dependency)
+			}
+		}
+
+		g.dependencies[component] = dependencies
+	}
+
+	if cycle := g.findCycle(); cycle != nil {
+		return nil, fmt.Errorf("there is a dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	return g, nil
+}
+
+// Dependencies returns the components the component directly depends on.
+func (g *Graph) Dependencies(component string) []string {
+	return g.dependencies[component]
+}
+
+// Dependents returns the components that directly depend on the component.
+func (g *Graph) Dependents(component string) []string {
+	dependents := []string{}
+
+	for _, other := range g.components {
+		for _, dependency := range g.dependencies[other] {
+			if dependency == component {
+				dependents = append(dependents, other)
+			}
+		}
+	}
+
+	return dependents
+}
+
+// Levels groups the components so that every component only depends on
+// components of the previous levels. The components of the same level don't
+// depend on each other, and they are sorted by name.
+func (g *Graph) Levels() [][]string {
+	levels := [][]string{}
+	done := map[string]bool{}
+
+	for len(done) < len(g.components) {
+		level := []string{}
+
+		for _, component := range g.components {
+			if done[component] {
+				continue
+			}
+
+			ready := true
+			for _, dependency := range g.dependencies[component] {
+				if done[dependency] == false {
+					ready = false
+				}
+			}
+
+			if ready {
+				level = append(level, component)
+			}
+		}
+
+		for _, component := range level {
+			done[component] = true
+		}
+
+		levels = append(levels, level)
+	}
+
+	return levels
+}
+
+// Order returns the components in the order they should be applied, with
+// every component after all its dependencies.
+func (g *Graph) Order() []string {
+	order := []string{}
+
+	for _, level := range g.Levels() {
+		order = append(order, level...)
+	}
+
+	return order
+}
+
+// ReverseOrder returns the components in the order they should be destroyed,
+// with every component before all its dependencies.
+func (g *Graph) ReverseOrder() []string {
+	order := g.Order()
+
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+
+	return order
+}
+
+// Subgraph returns the graph of only the given components. The dependencies
+// on the components that are left out are dropped.
+func (g *Graph) Subgraph(components []string) *Graph {
+	keep := map[string]bool{}
+	for _, component := range components {
+		keep[component] = true
+	}
+
+	sub := &Graph{dependencies: map[string][]string{}}
+
+	for _, component := range g.components {
+		if keep[component] == false {
+			continue
+		}
+
+		sub.components = append(sub.components, component)
+
+		dependencies := []string{}
+		for _, dependency := range g.dependencies[component] {
+			if keep[dependency] {
+				dependencies = append(dependencies, dependency)
+			}
+		}
+		sub.dependencies[component] = dependencies
+	}
+
+	return sub
+}
+
+// findCycle returns the components of a dependency cycle, or nil if there is
+// none.
+func (g *Graph) findCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := map[string]int{}
+	stack := []string{}
+
+	var visit func(component string) []string
+	visit = func(component string) []string {
+		state[component] = visiting
+		stack = append(stack, component)
+
+		for _, dependency := range g.dependencies[component] {
+			switch state[dependency] {
+			case visiting:
+				for i, c := range stack {
+					if c == dependency {
+						return append(append([]string{}, stack[i:]...), dependency)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dependency); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[component] = visited
+
+		return nil
+	}
+
+	for _, component := range g.components {
+		if state[component] == unvisited {
+			if cycle := visit(component); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package tf
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// These helpers read just enough of the terraform configuration of a
+// component for tf to show it, they are not a full HCL parser.
+
+// Block is a block of the terraform configuration, like `backend "s3" {}`.
+type Block struct {
+	Labels []string
+
+	// Body is the text between the braces of the block.
+	Body string
+}
+
+var (
+	reBlockLabel       = regexp.MustCompile(`"([^"]*)"`)
+	reStringAttribute  = regexp.MustCompile(`(?m)^\s*([\w-]+)\s*=\s*"([^"]*)"`)
+	reAttribute        = regexp.MustCompile(`^\s*([\w-]+)\s*=\s*(.*)$`)
+	reCommentOrLiteral = regexp.MustCompile(`(?s)"(?:[^"\\]|\\.)*"|#[^\n]*|//[^\n]*|/\*.*?\*/`)
+)
+
+// ReadConfig returns the content of all the .tf files of the component, with
+// the comments removed.
+func ReadConfig(component string) (string, error) {
+	files, err := filepath.Glob(filepath.Join(component, "*.tf"))
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	config := ""
+	for _, file := range files {
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		config += string(body) + "\n"
+	}
+
+	return stripComments(config), nil
+}
+
+// stripComments removes the comments from the configuration, leaving the
+// strings that look like comments alone.
+func stripComments(config string) string {
+	return reCommentOrLiteral.ReplaceAllStringFunc(config, func(match string) string {
+		if strings.HasPrefix(match, `"`) {
+			return match
+		}
+		return ""
+	})
+}
+
+// FindBlocks returns all the blocks of the given type, at any depth.
+func FindBlocks(config string, blockType string) []Block {
+	re := regexp.MustCompile(`(?m)(?:^|[\s{])` + regexp.QuoteMeta(blockType) + `((?:\s+"[^"]*"|\s+[\w-]+)*)\s*\{`)
+
+	blocks := []Block{}
+
+	for _, match := range re.FindAllStringSubmatchIndex(config, -1) {
+		labels := []string{}
+		for _, label := range reBlockLabel.FindAllStringSubmatch(config[match[2]:match[3]], -1) {
+			labels = append(labels, label[1])
+		}
+		if len(labels) == 0 {
+			labels = strings.Fields(config[match[2]:match[3]])
+		}
+
+		start := match[1]
+		end := closingBrace(config, start)
+		blocks = append(blocks, Block{Labels: labels, Body: config[start:end]})
+	}
+
+	return blocks
+}
+
+// StringAttributes returns the attributes of the body that have a literal
+// string value.
+func StringAttributes(body string) map[string]string {
+	attributes := map[string]string{}
+
+	for _, match := range reStringAttribute.FindAllStringSubmatch(body, -1) {
+		if _, ok := attributes[match[1]]; ok == false {
+			attributes[match[1]] = match[2]
+		}
+	}
+
+	return attributes
+}
+
+// Attributes returns the attributes defined directly in the body (not in
+// its nested blocks), with their value as it is written in the file.
+func Attributes(body string) map[string]string {
+	attributes := map[string]string{}
+
+	depth := 0
+	name := ""
+	value := ""
+
+	for _, line := range strings.Split(body, "\n") {
+		if depth == 0 && name == "" {
+			if match := reAttribute.FindStringSubmatch(line); match != nil {
+				name = match[1]
+				line = match[2]
+			}
+		}
+
+		if name != "" {
+			value += line + "\n"
+		}
+
+		depth += bracketDepth(line)
+
+		if name != "" && depth <= 0 {
+			attributes[name] = strings.TrimSpace(value)
+			name = ""
+			value = ""
+			depth = 0
+		}
+	}
+
+	return attributes
+}
+
+// bracketDepth returns how many brackets the line opens minus how many it
+// closes, ignoring the ones inside strings.
+func bracketDepth(line string) int {
+	depth := 0
+	inString := false
+
+	for i := 0; i < len(line); i++ {
+		switch {
+		case inString && line[i] == '\\':
+			i++
+		case line[i] == '"':
+			inString = !inString
+		case inString:
+		case strings.IndexByte("{[(", line[i]) >= 0:
+			depth++
+		case strings.IndexByte("}])", line[i]) >= 0:
+			depth--
+		}
+	}
+
+	return depth
+}
+
+// closingBrace returns the position of the brace closing the block whose
+// body starts at start, skipping the braces inside strings.
+func closingBrace(config string, start int) int {
+	depth := 1
+	inString := false
+
+	for i := start; i < len(config); i++ {
+		switch {
+		case inString && config[i] == '\\':
+			i++
+		case config[i] == '"':
+			inString = !inString
+		case inString:
+		case config[i] == '{':
+			depth++
+		case config[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return len(config)
+}
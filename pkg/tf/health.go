@@ -0,0 +1,152 @@
+package tf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HealthCheck is a check that is run after a component is applied to make
+// sure that what it manages is working. Exactly one of HTTP, TCP and Command
+// should be set.
+type HealthCheck struct {
+	Name string `yaml:"name"`
+
+	// HTTP is a URL that should answer with a 2xx status code.
+	HTTP string `yaml:"http"`
+
+	// TCP is a host:port that should accept connections.
+	TCP string `yaml:"tcp"`
+
+	// Command is a shell command, run in the component, that should exit
+	// with status 0.
+	Command string `yaml:"command"`
+
+	// Retries is how many times the check is retried before failing, waiting
+	// Interval between the attempts. Each attempt can take up to Timeout.
+	Retries  int           `yaml:"retries"`
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// HealthResult is the result of a health check.
+type HealthResult struct {
+	Check    HealthCheck
+	Attempts int
+	Duration time.Duration
+
+	// Err is nil if the check passed.
+	Err error
+}
+
+const (
+	defaultHealthInterval = 10 * time.Second
+	defaultHealthTimeout  = 10 * time.Second
+)
+
+// String returns the name of the check, or what it checks if it has no name.
+func (c HealthCheck) String() string {
+	switch {
+	case c.Name != "":
+		return c.Name
+	case c.HTTP != "":
+		return c.HTTP
+	case c.TCP != "":
+		return "tcp " + c.TCP
+	default:
+		return c.Command
+	}
+}
+
+// RunHealthChecks runs the health checks of the component, returning their
+// results in the same order.
+func (r *Runner) RunHealthChecks(component string, checks []HealthCheck) []HealthResult {
+	results := []HealthResult{}
+
+	for _, check := range checks {
+		if r.DryRun {
+			r.echoCommand(fmt.Sprintf("health check '%s' in '%s'", check, component))
+			continue
+		}
+
+		results = append(results, runHealthCheck(component, check))
+	}
+
+	return results
+}
+
+func runHealthCheck(component string, check HealthCheck) HealthResult {
+	if check.Interval == 0 {
+		check.Interval = defaultHealthInterval
+	}
+	if check.Timeout == 0 {
+		check.Timeout = defaultHealthTimeout
+	}
+
+	result := HealthResult{Check: check}
+	start := time.Now()
+
+	for {
+		result.Attempts++
+		result.Err = healthAttempt(component, check)
+
+		if result.Err == nil || result.Attempts > check.Retries {
+			break
+		}
+
+		time.Sleep(check.Interval)
+	}
+
+	result.Duration = time.Since(start)
+
+	return result
+}
+
+func healthAttempt(component string, check HealthCheck) error {
+	ctx, cancel := context.WithTimeout(context.Background(), check.Timeout)
+	defer cancel()
+
+	switch {
+	case check.HTTP != "":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, check.HTTP, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("status %s", resp.Status)
+		}
+
+		return nil
+
+	case check.TCP != "":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", check.TCP)
+		if err != nil {
+			return err
+		}
+
+		return conn.Close()
+
+	case check.Command != "":
+		cmd := ShellCommand(ctx, check.Command)
+		cmd.Dir = component
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %s", err, out)
+		}
+
+		return nil
+
+	default:
+		return fmt.Errorf("the health check has no http, tcp or command")
+	}
+}
@@ -0,0 +1,83 @@
+package tf
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// These are the hooks of a component.
+const (
+	// HookBeforePlan is run before terraform runs to plan, apply or
+	// destroy the component (and before its init, if it needs one).
+	HookBeforePlan = "before_plan"
+	// HookAfterApply is run after a successful apply, before the
+	// outputs are published.
+	HookAfterApply = "after_apply"
+	// HookOnFailure is run when the plan, apply or destroy of the
+	// component fails.
+	HookOnFailure = "on_failure"
+)
+
+// Hooks are the shell commands that the component.yaml of a component runs
+// around terraform, like fetching secrets or setting up a kubeconfig.
+type Hooks struct {
+	BeforePlan []string `yaml:"before_plan"`
+	AfterApply []string `yaml:"after_apply"`
+	OnFailure  []string `yaml:"on_failure"`
+}
+
+// Commands returns the commands of the hook.
+func (h Hooks) Commands(hook string) []string {
+	switch hook {
+	case HookBeforePlan:
+		return h.BeforePlan
+	case HookAfterApply:
+		return h.AfterApply
+	case HookOnFailure:
+		return h.OnFailure
+	}
+
+	return nil
+}
+
+// RunHook runs the commands of the hook of the component one after the other
+// in the component, with the same environment as terraform. It stops at the
+// first command that fails.
+func (r *Runner) RunHook(component string, hook string) error {
+	metadata, err := GetMetadata(component)
+	if err != nil {
+		return err
+	}
+
+	for _, command := range metadata.Hooks.Commands(hook) {
+		r.echoCommand(fmt.Sprintf("cd %s && %s", QuoteArg(component), command))
+		if r.DryRun {
+			continue
+		}
+
+		cmd := ShellCommand(context.Background(), command)
+		cmd.Dir = component
+		cmd.Env = r.environ(component)
+		cmd.Stdout = r.Stdout
+		cmd.Stderr = r.Stderr
+
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("the %s hook '%s' failed: %w", hook, command, err)
+		}
+	}
+
+	return nil
+}
+
+// ShellCommand returns the command that runs the command line in the shell
+// of the platform: "sh -c" on Unix and "cmd /C" on Windows, where sh is
+// usually missing. It is killed when ctx is done.
+func ShellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,26 @@
+package tf
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestShellCommand(t *testing.T) {
+	dir := t.TempDir()
+
+	cmd := ShellCommand(context.Background(), "echo hello && exit 0")
+	cmd.Dir = dir
+
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("ShellCommand failed: %s", err)
+	}
+	if strings.TrimSpace(string(out)) != "hello" {
+		t.Errorf("ShellCommand printed %q, want %q", out, "hello")
+	}
+
+	if err := ShellCommand(context.Background(), "exit 3").Run(); err == nil {
+		t.Errorf("ShellCommand of a command that fails should fail")
+	}
+}
@@ -0,0 +1,143 @@
+package tf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InitReason returns why the component has to be initialized before running
+// plan or apply, or an empty string if it is already initialized: either
+// the .terraform directory is missing, or a provider of the dependency lock
+// file is not installed in the version it selects.
+func InitReason(component string) (string, error) {
+	return initReason(component, DefaultRegistry)
+}
+
+// InitReason is like the InitReason function, but the providers are looked
+// for in the registry of the binary the runner runs in the component.
+func (r *Runner) InitReason(component string) (string, error) {
+	return initReason(component, r.registry(component))
+}
+
+// registry returns the Registry of the binary of the component: the one of
+// its settings in the project config, or else the one of the runner.
+func (r *Runner) registry(component string) string {
+	if binary := r.Components[component].Binary; binary != "" {
+		return Registry(binary)
+	}
+
+	return Registry(r.Binary)
+}
+
+func initReason(component string, registry string) (string, error) {
+	// terragrunt initializes the components by itself, in its cache.
+	if IsTerragrunt(component) {
+		return "", nil
+	}
+
+	dotTerraform := filepath.Join(component, ".terraform")
+
+	if _, err := os.Stat(dotTerraform); os.IsNotExist(err) {
+		return "it was never initialized", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	providers, err := GetRegistryProviders(component, registry)
+	if err != nil {
+		return "", err
+	}
+
+	for _, provider := range providers {
+		if provider.Version == "" {
+			return fmt.Sprintf("%s is not in the dependency lock file", provider.Source), nil
+		}
+
+		installed := filepath.Join(dotTerraform, "providers", filepath.FromSlash(provider.Source), provider.Version)
+		if _, err := os.Stat(installed); os.IsNotExist(err) {
+			return fmt.Sprintf("%s %s is not installed", provider.Source, provider.Version), nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
+
+// Init runs "terraform init" inside the component, and then selects the
+// workspace of the runner (creating it if it doesn't exist).
+func (r *Runner) Init(component string, args ...string) error {
+	// terraform refuses to init when TF_WORKSPACE is a workspace that
+	// doesn't exist yet, so the workspace is only selected afterwards.
+	noWorkspace := *r
+	noWorkspace.Workspace = ""
+
+	if err := noWorkspace.Run(component, append([]string{"init", "-input=false"}, args...)...); err != nil {
+		return err
+	}
+
+	return r.SelectWorkspace(component)
+}
+
+// SelectWorkspace selects the workspace of the runner in the component,
+// creating it if it doesn't exist. It does nothing if the runner has no
+// workspace.
+func (r *Runner) SelectWorkspace(component string) error {
+	if r.Workspace == "" {
+		return nil
+	}
+
+	// terraform doesn't allow to select a workspace while TF_WORKSPACE is
+	// set, and its output would mix with the one of the command.
+	noWorkspace := *r
+	noWorkspace.Workspace = ""
+
+	// "workspace select -or-create" needs terraform 1.4, so the workspace
+	// is looked for in the list and created if it is not there.
+	list, err := noWorkspace.Output(component, "workspace", "list")
+	if err != nil {
+		return fmt.Errorf("could not list the workspaces: %w", err)
+	}
+
+	command := "new"
+	for _, line := range strings.Split(string(list), "\n") {
+		if strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "*")) == r.Workspace {
+			command = "select"
+			break
+		}
+	}
+	// In dry-run mode there is no list to look in.
+	if r.DryRun {
+		command = "select"
+	}
+
+	if _, err := noWorkspace.Output(component, "workspace", command, r.Workspace); err != nil {
+		return fmt.Errorf("could not select the '%s' workspace: %w", r.Workspace, err)
+	}
+
+	return nil
+}
+
+// EnsureInit initializes the component if Runner.InitReason says it needs
+// it, telling the user why on Stderr, and otherwise it makes sure that the
+// workspace of the runner exists.
+func (r *Runner) EnsureInit(component string) error {
+	reason, err := r.InitReason(component)
+	if err != nil {
+		return err
+	}
+	if reason == "" {
+		Log(LogDebug, "already initialized", "component", component)
+		return r.SelectWorkspace(component)
+	}
+
+	fmt.Fprintf(r.Stderr, "Initializing '%s' because %s.\n", component, reason)
+
+	if err := r.Init(component); err != nil {
+		return fmt.Errorf("terraform init failed: %w", err)
+	}
+
+	return nil
+}
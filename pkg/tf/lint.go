@@ -0,0 +1,102 @@
+package tf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// TflintBinary is the executable of tflint, the linter of the components.
+const TflintBinary = "tflint"
+
+// TflintConfig is the tflint config shared by all the components, where tf is
+// run.
+const TflintConfig = ".tflint.hcl"
+
+// LintIssue is an issue found by tflint in a component.
+type LintIssue struct {
+	Rule     string
+	Severity string
+	Message  string
+
+	// File is relative to the component.
+	File   string
+	Line   int
+	Column int
+}
+
+// String returns the issue like a compiler would.
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s (%s)", i.File, i.Line, i.Column, i.Severity, i.Message, i.Rule)
+}
+
+// Lint runs tflint in the component, with the shared config of the root if
+// there is one, and returns the issues it found.
+func (r *Runner) Lint(root string, component string) ([]LintIssue, error) {
+	// --force makes tflint exit with 0 when it finds issues, so that only
+	// the errors make it fail.
+	args := []string{"--format", "json", "--force"}
+	config := filepath.Join(root, TflintConfig)
+	if _, err := os.Stat(config); err == nil {
+		args = append(args, "--config", config)
+	}
+
+	r.echoCommand(fmt.Sprintf("cd %s && %s", QuoteArg(component), FormatCommand(TflintBinary, args)))
+	if r.DryRun {
+		return nil, nil
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command(TflintBinary, args...)
+	cmd.Dir = component
+	cmd.Stdout = &out
+	cmd.Stderr = r.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("tflint failed: %w", err)
+	}
+
+	var report struct {
+		Issues []struct {
+			Rule struct {
+				Name     string `json:"name"`
+				Severity string `json:"severity"`
+			} `json:"rule"`
+			Message string `json:"message"`
+			Range   struct {
+				Filename string `json:"filename"`
+				Start    struct {
+					Line   int `json:"line"`
+					Column int `json:"column"`
+				} `json:"start"`
+			} `json:"range"`
+		} `json:"issues"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		return nil, fmt.Errorf("could not unmarshal the output of tflint: %w", err)
+	}
+
+	if len(report.Errors) > 0 {
+		return nil, fmt.Errorf("tflint failed: %s", report.Errors[0].Message)
+	}
+
+	issues := []LintIssue{}
+	for _, issue := range report.Issues {
+		issues = append(issues, LintIssue{
+			Rule:     issue.Rule.Name,
+			Severity: issue.Rule.Severity,
+			Message:  issue.Message,
+			File:     filepath.ToSlash(issue.Range.Filename),
+			Line:     issue.Range.Start.Line,
+			Column:   issue.Range.Start.Column,
+		})
+	}
+
+	return issues, nil
+}
@@ -0,0 +1,334 @@
+package tf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// LocksDir is the folder, relative to the root, where the locks of the
+// components are stored while a command changes them.
+const LocksDir = ".tf/locks"
+
+// LocksConfig says where else the locks of the components are taken besides
+// LocksDir, whose files only protect the invocations that share the same
+// directory.
+type LocksConfig struct {
+	// Consul is the prefix of the Consul KV keys of the locks, like
+	// "tf/locks", so that the invocations of other checkouts and hosts are
+	// locked out too. Like for the published outputs, the address is in
+	// CONSUL_HTTP_ADDR and the token in CONSUL_HTTP_TOKEN.
+	Consul string `yaml:"consul"`
+}
+
+// Lock tells who is running a command on a component.
+type Lock struct {
+	User    string    `json:"user"`
+	Host    string    `json:"host"`
+	PID     int       `json:"pid"`
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+}
+
+// String describes who holds the lock.
+func (l Lock) String() string {
+	return fmt.Sprintf("%s@%s (pid %d), running '%s' since %s", l.User, l.Host, l.PID, l.Command, l.Time.Local().Format("2006-01-02 15:04:05"))
+}
+
+// LockedError is returned by AcquireLock when the component is already
+// locked by someone else.
+type LockedError struct {
+	Component string
+	Lock      Lock
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("'%s' is locked by %s", e.Component, e.Lock)
+}
+
+// LockPath returns the path of the lock file of the component.
+func LockPath(root string, component string) string {
+	return filepath.Join(root, LocksDir, filepath.FromSlash(component)+".lock")
+}
+
+// AcquireLock locks the component for the command, returning a function that
+// releases the lock. It returns a *LockedError if the component is already
+// locked. A lock left behind by a process that doesn't run anymore on this
+// host is stale, so it is replaced.
+func AcquireLock(root string, component string, command string) (func() error, error) {
+	path := LockPath(root, component)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	lock := newLock(command)
+	body, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	// O_EXCL makes the creation fail if the file exists, so only one of
+	// two invocations can create it.
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		held, readErr := ReadLock(root, component)
+		if readErr != nil {
+			return nil, fmt.Errorf("'%s' is locked, but the lock can't be read: %w", component, readErr)
+		}
+		if held.Stale(lock.Host) == false {
+			return nil, &LockedError{Component: component, Lock: held}
+		}
+
+		Log(LogVerbose, "replacing a stale lock", "component", component, "lock", held)
+		if removeErr := os.Remove(path); removeErr != nil && os.IsNotExist(removeErr) == false {
+			return nil, removeErr
+		}
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			// Someone else replaced it first.
+			return nil, &LockedError{Component: component, Lock: held}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = file.Write(append(body, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	Log(LogDebug, "acquired the lock", "component", component, "file", path)
+
+	return func() error {
+		Log(LogDebug, "releasing the lock", "component", component)
+		return os.Remove(path)
+	}, nil
+}
+
+// newLock returns the lock of this process for the command.
+func newLock(command string) Lock {
+	lock := Lock{User: currentUser(), PID: os.Getpid(), Command: command, Time: time.Now().UTC()}
+	lock.Host, _ = os.Hostname()
+
+	return lock
+}
+
+// Stale returns true if the lock was left behind by a process of host that
+// doesn't run anymore. The locks of the other hosts are never stale, since
+// their processes can't be checked.
+func (l Lock) Stale(host string) bool {
+	if host == "" || l.Host != host || l.PID <= 0 {
+		return false
+	}
+
+	return processRuns(l.PID) == false
+}
+
+// processRuns returns true if a process with the pid runs on this host.
+func processRuns(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		// FindProcess only fails on Windows, when there is no such
+		// process.
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+
+	// The signal 0 only checks that the process exists, and it exists if
+	// it belongs to someone else too.
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+// ReadLock returns the lock of the component.
+func ReadLock(root string, component string) (Lock, error) {
+	body, err := ioutil.ReadFile(LockPath(root, component))
+	if err != nil {
+		return Lock{}, err
+	}
+
+	var lock Lock
+	if err := json.Unmarshal(body, &lock); err != nil {
+		return Lock{}, fmt.Errorf("could not unmarshal the lock of '%s': %w", component, err)
+	}
+
+	return lock, nil
+}
+
+// RemoveLock removes the lock of the component, whoever holds it.
+func RemoveLock(root string, component string) error {
+	Log(LogDebug, "removing the lock", "component", component)
+
+	return os.Remove(LockPath(root, component))
+}
+
+// AcquireRemoteLock locks the component for the command in the remote
+// backend of the config, like AcquireLock does with the files. The lock is
+// created only if the key doesn't exist, using the check-and-set of Consul,
+// and a stale lock is replaced only if nobody changed it in the meantime. If
+// the config has no backend, nothing is locked.
+func AcquireRemoteLock(config LocksConfig, component string, command string) (func() error, error) {
+	if config.Consul == "" {
+		return func() error { return nil }, nil
+	}
+
+	kvURL := consulKVURL(path.Join(config.Consul, component))
+	lock := newLock(command)
+
+	acquired, err := consulLock(kvURL, lock, 0)
+	if err == nil && acquired == false {
+		held, index, readErr := readConsulLock(kvURL)
+		if os.IsNotExist(readErr) {
+			// It was released in the meantime: the key is created like
+			// the first time.
+			index = 0
+		} else if readErr != nil {
+			return nil, fmt.Errorf("'%s' is locked in Consul, but the lock can't be read: %w", component, readErr)
+		} else if held.Stale(lock.Host) == false {
+			return nil, &LockedError{Component: component, Lock: held}
+		} else {
+			Log(LogVerbose, "replacing a stale lock", "component", component, "lock", held)
+		}
+
+		acquired, err = consulLock(kvURL, lock, index)
+		if err == nil && acquired == false {
+			return nil, fmt.Errorf("'%s' was locked by someone else in the meantime", component)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not lock '%s' in Consul: %w", component, err)
+	}
+
+	Log(LogDebug, "acquired the lock", "component", component, "key", kvURL)
+
+	return func() error {
+		Log(LogDebug, "releasing the lock", "component", component, "key", kvURL)
+		return deleteConsulLock(kvURL)
+	}, nil
+}
+
+// ReadRemoteLock returns the lock of the component in the remote backend of
+// the config. Like ReadLock, the error satisfies os.IsNotExist if the
+// component is not locked there.
+func ReadRemoteLock(config LocksConfig, component string) (Lock, error) {
+	if config.Consul == "" {
+		return Lock{}, os.ErrNotExist
+	}
+
+	lock, _, err := readConsulLock(consulKVURL(path.Join(config.Consul, component)))
+	return lock, err
+}
+
+// RemoveRemoteLock removes the lock of the component in the remote backend
+// of the config, whoever holds it.
+func RemoveRemoteLock(config LocksConfig, component string) error {
+	if config.Consul == "" {
+		return nil
+	}
+
+	Log(LogDebug, "removing the lock", "component", component, "consul", config.Consul)
+
+	return deleteConsulLock(consulKVURL(path.Join(config.Consul, component)))
+}
+
+// consulLock writes the lock to the key if its modify index is still index,
+// 0 meaning that the key doesn't exist. It returns false if it was not
+// written because of that.
+func consulLock(kvURL string, lock Lock, index uint64) (bool, error) {
+	body, err := json.Marshal(lock)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := consulRequest(http.MethodPut, fmt.Sprintf("%s?cas=%d", kvURL, index), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("PUT %s: %s", kvURL, resp.Status)
+	}
+
+	written, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(string(written)) == "true", nil
+}
+
+// readConsulLock returns the lock in the key, and its modify index.
+func readConsulLock(kvURL string) (Lock, uint64, error) {
+	resp, err := consulRequest(http.MethodGet, kvURL, nil)
+	if err != nil {
+		return Lock{}, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return Lock{}, 0, os.ErrNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Lock{}, 0, fmt.Errorf("GET %s: %s", kvURL, resp.Status)
+	}
+
+	// The values are base64 encoded, which is how encoding/json unmarshals
+	// a []byte.
+	var pairs []struct {
+		ModifyIndex uint64
+		Value       []byte
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return Lock{}, 0, fmt.Errorf("could not unmarshal %s: %w", kvURL, err)
+	}
+	if len(pairs) == 0 {
+		return Lock{}, 0, os.ErrNotExist
+	}
+
+	var lock Lock
+	if err := json.Unmarshal(pairs[0].Value, &lock); err != nil {
+		return Lock{}, 0, fmt.Errorf("could not unmarshal the lock in %s: %w", kvURL, err)
+	}
+
+	return lock, pairs[0].ModifyIndex, nil
+}
+
+func deleteConsulLock(kvURL string) error {
+	resp, err := consulRequest(http.MethodDelete, kvURL, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("DELETE %s: %s", kvURL, resp.Status)
+	}
+
+	return nil
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return os.Getenv("USER")
+}
@@ -0,0 +1,114 @@
+package tf
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// serveConsul serves a Consul KV with the check-and-set of the PUTs, and
+// points CONSUL_HTTP_ADDR to it.
+func serveConsul(t *testing.T) {
+	var mu sync.Mutex
+	values := map[string][]byte{}
+	indexes := map[string]uint64{}
+	var index uint64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		key := r.URL.Path
+		switch r.Method {
+		case http.MethodGet:
+			if _, ok := values[key]; ok == false {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode([]map[string]interface{}{{"ModifyIndex": indexes[key], "Value": values[key]}})
+		case http.MethodPut:
+			if cas := r.URL.Query().Get("cas"); cas != "" {
+				if want, _ := strconv.ParseUint(cas, 10, 64); want != indexes[key] {
+					w.Write([]byte("false"))
+					return
+				}
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			index++
+			values[key] = body
+			indexes[key] = index
+			w.Write([]byte("true"))
+		case http.MethodDelete:
+			delete(values, key)
+			delete(indexes, key)
+			w.Write([]byte("true"))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	os.Setenv("CONSUL_HTTP_ADDR", server.URL)
+	t.Cleanup(func() { os.Unsetenv("CONSUL_HTTP_ADDR") })
+}
+
+func TestAcquireRemoteLock(t *testing.T) {
+	serveConsul(t)
+	config := LocksConfig{Consul: "tf/locks"}
+
+	release, err := AcquireRemoteLock(config, "network/vpc", "apply")
+	if err != nil {
+		t.Fatalf("AcquireRemoteLock failed: %s", err)
+	}
+
+	lock, err := ReadRemoteLock(config, "network/vpc")
+	if err != nil || lock.Command != "apply" || lock.PID != os.Getpid() {
+		t.Errorf("ReadRemoteLock returned %v (%v), want the lock of the apply", lock, err)
+	}
+
+	_, err = AcquireRemoteLock(config, "network/vpc", "destroy")
+	if lockedErr, ok := err.(*LockedError); ok == false || lockedErr.Lock.Command != "apply" {
+		t.Errorf("AcquireRemoteLock of a locked component returned %v, want a *LockedError", err)
+	}
+
+	if err := release(); err != nil {
+		t.Fatalf("releasing the lock failed: %s", err)
+	}
+	if _, err := ReadRemoteLock(config, "network/vpc"); os.IsNotExist(err) == false {
+		t.Errorf("ReadRemoteLock of a released lock returned %v, want a not exist error", err)
+	}
+
+	release, err = AcquireRemoteLock(config, "network/vpc", "destroy")
+	if err != nil {
+		t.Fatalf("AcquireRemoteLock of a released lock failed: %s", err)
+	}
+	release()
+}
+
+func TestAcquireRemoteLockStale(t *testing.T) {
+	serveConsul(t)
+	config := LocksConfig{Consul: "tf/locks"}
+
+	// A lock of a process of this host that doesn't run anymore.
+	stale := newLock("apply")
+	stale.PID = 1 << 22
+	if processRuns(stale.PID) {
+		t.Skip("the pid of the stale lock runs")
+	}
+	if written, err := consulLock(consulKVURL("tf/locks/app"), stale, 0); err != nil || written == false {
+		t.Fatalf("could not write the stale lock: %v", err)
+	}
+
+	release, err := AcquireRemoteLock(config, "app", "destroy")
+	if err != nil {
+		t.Fatalf("AcquireRemoteLock didn't replace the stale lock: %s", err)
+	}
+	defer release()
+
+	if lock, err := ReadRemoteLock(config, "app"); err != nil || lock.Command != "destroy" {
+		t.Errorf("ReadRemoteLock returned %v (%v), want the lock of the destroy", lock, err)
+	}
+}
@@ -0,0 +1,85 @@
+package tf
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// These are the levels of the log of what tf itself does.
+const (
+	// LogOff logs nothing, which is the default.
+	LogOff = iota
+
+	// LogVerbose logs the commands that are run and how long they take.
+	LogVerbose
+
+	// LogDebug also logs the details, like the directories that are
+	// walked to find the components.
+	LogDebug
+)
+
+// LogLevel is the level of the messages that are logged.
+var LogLevel = LogOff
+
+// LogOutput is where the log is written. It is stderr, so that the log is
+// not mixed with the output of terraform that scripts read.
+var LogOutput io.Writer = os.Stderr
+
+var logMu sync.Mutex
+
+// Log logs the message if the level is enabled, followed by the fields
+// given as key and value pairs, like:
+//
+//	time=10:15:00.123 level=verbose msg="running terraform" component=network
+func Log(level int, msg string, keyvals ...interface{}) {
+	if level > LogLevel {
+		return
+	}
+
+	levelName := "verbose"
+	if level == LogDebug {
+		levelName = "debug"
+	}
+
+	var line strings.Builder
+	line.WriteString("time=" + time.Now().Format("15:04:05.000"))
+	line.WriteString(" level=" + levelName)
+	line.WriteString(" msg=" + logValue(msg))
+
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		line.WriteString(fmt.Sprintf(" %v=%s", keyvals[i], logValue(keyvals[i+1])))
+	}
+	line.WriteString("\n")
+
+	// The components that run at the same time log at the same time.
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	io.WriteString(LogOutput, line.String())
+}
+
+// logValue formats the value of a field, quoting it if it has spaces or
+// quotes.
+func logValue(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case time.Duration:
+		s = v.Round(time.Millisecond).String()
+	case []string:
+		s = strings.Join(v, " ")
+	case error:
+		s = v.Error()
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return fmt.Sprintf("%q", s)
+	}
+
+	return s
+}
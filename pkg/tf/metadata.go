@@ -0,0 +1,94 @@
+package tf
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MetadataFile is the name of the optional file that describes a component.
+const MetadataFile = "component.yaml"
+
+// Metadata is what the component.yaml of a component says about it.
+type Metadata struct {
+	Owner       string            `yaml:"owner"`
+	Description string            `yaml:"description"`
+	Tier        string            `yaml:"tier"`
+	Labels      map[string]string `yaml:"labels"`
+
+	// Publish says where to publish the outputs after an apply.
+	Publish PublishConfig `yaml:"publish"`
+
+	// HealthChecks are run after every successful apply.
+	HealthChecks []HealthCheck `yaml:"health_checks"`
+
+	// Tests are the smoke tests run after the health checks.
+	Tests []SmokeTest `yaml:"tests"`
+
+	// Hooks are the commands run around terraform.
+	Hooks Hooks `yaml:"hooks"`
+}
+
+// GetMetadata reads the component.yaml of the component, returning empty
+// metadata if the component doesn't have one.
+func GetMetadata(component string) (Metadata, error) {
+	metadata := Metadata{Labels: map[string]string{}}
+
+	f, err := os.Open(filepath.Join(component, MetadataFile))
+	if os.IsNotExist(err) {
+		return metadata, nil
+	}
+	if err != nil {
+		return metadata, err
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(&metadata)
+	if err != nil && err != io.EOF {
+		return metadata, fmt.Errorf("could not read the %s of component '%s': %w", MetadataFile, component, err)
+	}
+
+	if metadata.Labels == nil {
+		metadata.Labels = map[string]string{}
+	}
+
+	return metadata, nil
+}
+
+// LabelsString returns the labels as a sorted, comma separated list of
+// key=value pairs.
+func (m Metadata) LabelsString() string {
+	labels := []string{}
+	for key, value := range m.Labels {
+		labels = append(labels, key+"="+value)
+	}
+	sort.Strings(labels)
+
+	return strings.Join(labels, ",")
+}
+
+// HasLabels returns true if the component has all the labels, each of them
+// being a key=value pair.
+func (m Metadata) HasLabels(labels []string) bool {
+	for _, label := range labels {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 {
+			return false
+		}
+
+		value, ok := m.Labels[parts[0]]
+		if ok == false || value != parts[1] {
+			return false
+		}
+	}
+
+	return true
+}
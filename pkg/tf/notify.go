@@ -0,0 +1,301 @@
+package tf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These are the types of the notifications sent when a component is applied,
+// and when the daemon finds that it has drifted.
+const (
+	NotifyStarted   = "apply_started"
+	NotifySucceeded = "apply_succeeded"
+	NotifyFailed    = "apply_failed"
+	NotifyDrift     = "drift_detected"
+)
+
+// NotificationsConfig says where the notifications of the applies and the
+// drifts are sent.
+// The URLs can use environment variables, like "${SLACK_WEBHOOK_URL}", to
+// keep the secrets out of tf.yaml.
+type NotificationsConfig struct {
+	// Slack are the URLs of Slack incoming webhooks.
+	Slack []string `yaml:"slack"`
+
+	// Webhooks are URLs that receive the Notification as JSON.
+	Webhooks []string `yaml:"webhooks"`
+
+	// Owners route the failures and the drifts of the components to their
+	// owner instead, by the owner of their component.yaml.
+	Owners map[string]OwnerNotifications `yaml:"owners"`
+
+	// SMTP is the server the emails of the owners are sent with.
+	SMTP SMTPConfig `yaml:"smtp"`
+}
+
+// OwnerNotifications says where the failures and the drifts of the
+// components of an owner are sent.
+type OwnerNotifications struct {
+	Slack    []string `yaml:"slack"`
+	Webhooks []string `yaml:"webhooks"`
+
+	// Email are the addresses, like the mailing list of the team, that
+	// get the notifications by email.
+	Email []string `yaml:"email"`
+
+	// Mention is put at the start of the Slack messages, like
+	// "<!subteam^S0123ABC>" to mention a Slack user group.
+	Mention string `yaml:"mention"`
+}
+
+// Enabled returns true if the notifications are sent somewhere.
+func (c NotificationsConfig) Enabled() bool {
+	if len(c.Slack) > 0 || len(c.Webhooks) > 0 {
+		return true
+	}
+
+	for _, owner := range c.Owners {
+		if len(owner.Slack) > 0 || len(owner.Webhooks) > 0 || len(owner.Email) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Route returns where the notification is sent: to the owner of the
+// component if it is a failure or a drift and the owner is in Owners, or
+// else to the Slack webhooks and the webhooks of the config.
+func (c NotificationsConfig) Route(notification Notification) OwnerNotifications {
+	if notification.Type == NotifyFailed || notification.Type == NotifyDrift {
+		if owner, ok := c.Owners[notification.Owner]; ok && notification.Owner != "" {
+			return owner
+		}
+	}
+
+	return OwnerNotifications{Slack: c.Slack, Webhooks: c.Webhooks}
+}
+
+// Notification is the JSON document posted to the webhooks. Like the events,
+// fields are only ever added to it, never removed or renamed.
+type Notification struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Component string    `json:"component"`
+	User      string    `json:"user"`
+	Host      string    `json:"host"`
+
+	// Owner is the owner of the component from its component.yaml, so
+	// that the right people see the notification.
+	Owner string `json:"owner,omitempty"`
+
+	// Changes are the number of resources added, changed and destroyed,
+	// when terraform printed them.
+	Changes *ChangeCounts `json:"changes,omitempty"`
+
+	// Error is only set for NotifyFailed.
+	Error string `json:"error,omitempty"`
+
+	// Tests are the results of the smoke tests run after the apply.
+	Tests []TestResult `json:"tests,omitempty"`
+}
+
+// ChangeCounts are the number of resources added, changed and destroyed by
+// an apply.
+type ChangeCounts struct {
+	Add     int `json:"add"`
+	Change  int `json:"change"`
+	Destroy int `json:"destroy"`
+}
+
+func (c ChangeCounts) String() string {
+	return fmt.Sprintf("%d added, %d changed, %d destroyed", c.Add, c.Change, c.Destroy)
+}
+
+// NewNotification returns a notification of the current user.
+func NewNotification(notificationType string, component string) Notification {
+	notification := Notification{Type: notificationType, Time: time.Now().UTC(), Component: component, User: currentUser()}
+	notification.Host, _ = os.Hostname()
+
+	// The owner only enriches the notification, a broken component.yaml
+	// is reported by the commands that need it.
+	metadata, _ := GetMetadata(component)
+	notification.Owner = metadata.Owner
+
+	return notification
+}
+
+// Text returns the notification as a message for humans, followed by the
+// results of the smoke tests and the owner of the component when there are.
+func (n Notification) Text() string {
+	text := n.text()
+	if len(n.Tests) > 0 {
+		text += fmt.Sprintf(" (smoke tests: %d of %d passed)", CountPassed(n.Tests), len(n.Tests))
+	}
+	if n.Owner != "" {
+		text += fmt.Sprintf(" (owner: %s)", n.Owner)
+	}
+
+	return text
+}
+
+func (n Notification) text() string {
+	switch n.Type {
+	case NotifyStarted:
+		return fmt.Sprintf("%s@%s started applying '%s'", n.User, n.Host, n.Component)
+	case NotifySucceeded:
+		if n.Changes != nil {
+			return fmt.Sprintf("%s@%s applied '%s': %s", n.User, n.Host, n.Component, n.Changes)
+		}
+		return fmt.Sprintf("%s@%s applied '%s'", n.User, n.Host, n.Component)
+	case NotifyDrift:
+		return fmt.Sprintf("'%s' has drifted from its state (checked by %s@%s)", n.Component, n.User, n.Host)
+	default:
+		return fmt.Sprintf("The apply of '%s' by %s@%s failed: %s", n.Component, n.User, n.Host, n.Error)
+	}
+}
+
+// Notify posts the notification to the Slack webhooks and to the webhooks
+// it is routed to, and emails it to the addresses. Failing webhooks and
+// emails are reported in stderr, but they never stop the apply.
+func (r *Runner) Notify(config NotificationsConfig, notification Notification) {
+	route := config.Route(notification)
+
+	text := notification.Text()
+	if route.Mention != "" {
+		text = route.Mention + " " + text
+	}
+
+	slack, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "Warning: could not encode the '%s' notification: %s\n", notification.Type, err)
+		return
+	}
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "Warning: could not encode the '%s' notification: %s\n", notification.Type, err)
+		return
+	}
+
+	for _, webhook := range route.Slack {
+		r.postWebhook(os.ExpandEnv(webhook), slack)
+	}
+	for _, webhook := range route.Webhooks {
+		r.postWebhook(os.ExpandEnv(webhook), body)
+	}
+	if len(route.Email) > 0 {
+		r.sendEmail(config.SMTP, route.Email, notification)
+	}
+}
+
+func (r *Runner) postWebhook(webhook string, body []byte) {
+	// The URLs of the webhooks usually contain a secret, so only their
+	// host is printed.
+	host := webhook
+	if u, err := url.Parse(webhook); err == nil {
+		host = u.Scheme + "://" + u.Host
+	}
+
+	r.echoCommand("POST " + host + "/...")
+	if r.DryRun {
+		return
+	}
+
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "Warning: could not notify %s: %s\n", host, redactURL(err, webhook, host))
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		fmt.Fprintf(r.Stderr, "Warning: could not notify %s: %s\n", host, resp.Status)
+	}
+}
+
+// redactURL returns the message of the error of the request without the full
+// URL of the webhook.
+func redactURL(err error, webhook string, host string) string {
+	return strings.ReplaceAll(err.Error(), webhook, host+"/...")
+}
+
+var (
+	planCountsRegexp    = regexp.MustCompile(`(\d+) to add, (\d+) to change, (\d+) to destroy`)
+	applyCountsRegexp   = regexp.MustCompile(`Resources: (\d+) added, (\d+) changed, (\d+) destroyed`)
+	destroyCountsRegexp = regexp.MustCompile(`Destroy complete! Resources: (\d+) destroyed`)
+)
+
+// ChangeCounter is a writer that passes the output of terraform through,
+// remembering the number of resources it says the plan and the apply change.
+type ChangeCounter struct {
+	w       io.Writer
+	partial []byte
+
+	// Planned and Applied are nil until terraform prints them.
+	Planned *ChangeCounts
+	Applied *ChangeCounts
+}
+
+// NewChangeCounter returns a ChangeCounter that writes to w.
+func NewChangeCounter(w io.Writer) *ChangeCounter {
+	return &ChangeCounter{w: w}
+}
+
+func (c *ChangeCounter) Write(p []byte) (int, error) {
+	c.partial = append(c.partial, p...)
+	for {
+		i := bytes.IndexByte(c.partial, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := c.partial[:i]
+		if counts := parseCounts(planCountsRegexp, line); counts != nil {
+			c.Planned = counts
+		}
+		if counts := parseCounts(applyCountsRegexp, line); counts != nil {
+			c.Applied = counts
+		}
+		if match := destroyCountsRegexp.FindSubmatch(line); match != nil {
+			destroy, _ := strconv.Atoi(string(match[1]))
+			c.Applied = &ChangeCounts{Destroy: destroy}
+		}
+		c.partial = c.partial[i+1:]
+	}
+
+	return c.w.Write(p)
+}
+
+// Changes returns the number of resources that were applied, or else the
+// ones that were planned, or nil if terraform printed neither.
+func (c *ChangeCounter) Changes() *ChangeCounts {
+	if c.Applied != nil {
+		return c.Applied
+	}
+
+	return c.Planned
+}
+
+func parseCounts(re *regexp.Regexp, line []byte) *ChangeCounts {
+	match := re.FindSubmatch(line)
+	if match == nil {
+		return nil
+	}
+
+	add, _ := strconv.Atoi(string(match[1]))
+	change, _ := strconv.Atoi(string(match[2]))
+	destroy, _ := strconv.Atoi(string(match[3]))
+
+	return &ChangeCounts{Add: add, Change: change, Destroy: destroy}
+}
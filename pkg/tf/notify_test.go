@@ -0,0 +1,106 @@
+package tf
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNotificationsRoute(t *testing.T) {
+	config := NotificationsConfig{
+		Slack: []string{"https://hooks.slack.com/all"},
+		Owners: map[string]OwnerNotifications{
+			"team-data": {Slack: []string{"https://hooks.slack.com/data"}, Mention: "<!subteam^S0123>"},
+		},
+	}
+	all := OwnerNotifications{Slack: []string{"https://hooks.slack.com/all"}}
+
+	tests := []struct {
+		notification Notification
+		want         OwnerNotifications
+	}{
+		{Notification{Type: NotifyFailed, Owner: "team-data"}, config.Owners["team-data"]},
+		{Notification{Type: NotifyDrift, Owner: "team-data"}, config.Owners["team-data"]},
+		{Notification{Type: NotifySucceeded, Owner: "team-data"}, all},
+		{Notification{Type: NotifyFailed, Owner: "team-web"}, all},
+		{Notification{Type: NotifyFailed}, all},
+	}
+
+	for _, test := range tests {
+		if got := config.Route(test.notification); reflect.DeepEqual(got, test.want) == false {
+			t.Errorf("the %s notification of %q is routed to %v, want %v", test.notification.Type, test.notification.Owner, got, test.want)
+		}
+	}
+}
+
+func TestNotifyEmail(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// A server that accepts everything, and sends what it got.
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- ""
+			return
+		}
+		defer conn.Close()
+
+		var got strings.Builder
+		reader := bufio.NewReader(conn)
+		conn.Write([]byte("220 localhost\r\n"))
+		data := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				break
+			}
+			got.WriteString(line)
+
+			switch {
+			case data && line == ".\r\n":
+				data = false
+				conn.Write([]byte("250 OK\r\n"))
+			case data:
+			case strings.HasPrefix(line, "DATA"):
+				data = true
+				conn.Write([]byte("354 Go on\r\n"))
+			case strings.HasPrefix(line, "QUIT"):
+				conn.Write([]byte("221 Bye\r\n"))
+				received <- got.String()
+				return
+			default:
+				conn.Write([]byte("250 OK\r\n"))
+			}
+		}
+		received <- got.String()
+	}()
+
+	var stderr strings.Builder
+	runner := &Runner{Stdout: ioutil.Discard, Stderr: &stderr}
+	config := NotificationsConfig{
+		SMTP: SMTPConfig{Address: listener.Addr().String(), From: "tf@example.com"},
+		Owners: map[string]OwnerNotifications{
+			"team-data": {Email: []string{"data@example.com"}},
+		},
+	}
+
+	runner.Notify(config, Notification{Type: NotifyFailed, Component: "rds-mysql", Owner: "team-data", Error: "exit status 1"})
+
+	got := <-received
+	if stderr.Len() > 0 {
+		t.Errorf("Notify printed %q", stderr.String())
+	}
+	for _, want := range []string{"MAIL FROM:<tf@example.com>", "RCPT TO:<data@example.com>", "Subject: [tf] The apply of 'rds-mysql'", "Error: exit status 1"} {
+		if strings.Contains(got, want) == false {
+			t.Errorf("the server got %q, without %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package tf
+
+import (
+	"sync"
+)
+
+// ParallelEach calls fn for every component, running at most jobs calls at
+// the same time. The index of the component is passed to fn so that the
+// results can be stored in order. It returns when all the calls are done.
+func ParallelEach(components []string, jobs int, fn func(i int, component string)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < jobs && w < len(components); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i, components[i])
+			}
+		}()
+	}
+
+	for i := range components {
+		indexes <- i
+	}
+	close(indexes)
+
+	wg.Wait()
+}
@@ -0,0 +1,124 @@
+package tf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// PlanSummary counts the changes of a terraform plan.
+type PlanSummary struct {
+	Add     []string
+	Change  []string
+	Destroy []string
+}
+
+// HasChanges returns true if the plan would change anything.
+func (s PlanSummary) HasChanges() bool {
+	return len(s.Add)+len(s.Change)+len(s.Destroy) > 0
+}
+
+// String returns the summary in the same words terraform uses.
+func (s PlanSummary) String() string {
+	return fmt.Sprintf("%d to add, %d to change, %d to destroy", len(s.Add), len(s.Change), len(s.Destroy))
+}
+
+// SummarizePlan returns the summary of the JSON representation of a plan,
+// the one printed by "terraform show -json <planfile>". A resource that is
+// replaced is counted both as added and as destroyed, like terraform does.
+func SummarizePlan(planJSON []byte) (PlanSummary, error) {
+	type plan struct {
+		ResourceChanges []struct {
+			Address string `json:"address"`
+			Change  struct {
+				Actions []string `json:"actions"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+	}
+
+	var p plan
+	if err := json.Unmarshal(planJSON, &p); err != nil {
+		return PlanSummary{}, fmt.Errorf("could not unmarshal the plan: %w", err)
+	}
+
+	s := PlanSummary{Add: []string{}, Change: []string{}, Destroy: []string{}}
+
+	for _, rc := range p.ResourceChanges {
+		for _, action := range rc.Change.Actions {
+			switch action {
+			case "create":
+				s.Add = append(s.Add, rc.Address)
+			case "update":
+				s.Change = append(s.Change, rc.Address)
+			case "delete":
+				s.Destroy = append(s.Destroy, rc.Address)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// SavePlan runs "terraform plan -out" in the component, saving the plan in a
+// new temporary file whose path is returned. The caller should remove it.
+func (r *Runner) SavePlan(component string, args ...string) (string, error) {
+	planFile, err := ioutil.TempFile("", "tf-*.tfplan")
+	if err != nil {
+		return "", err
+	}
+	planFile.Close()
+
+	if err := r.SavePlanFile(component, planFile.Name(), args...); err != nil {
+		os.Remove(planFile.Name())
+		return "", err
+	}
+
+	return planFile.Name(), nil
+}
+
+// SavePlanFile runs "terraform plan -out" in the component, saving the plan
+// in planFile, which has to be an absolute path.
+func (r *Runner) SavePlanFile(component string, planFile string, args ...string) error {
+	return r.Run(component, append([]string{"plan", "-out=" + planFile}, args...)...)
+}
+
+// WritePlanJSON writes the JSON representation of the plan saved in planFile
+// in a new temporary file, for the tools that read it, and returns its path.
+// The caller should remove it.
+func (r *Runner) WritePlanJSON(component string, planFile string) (string, error) {
+	planJSON, err := r.Output(component, "show", "-json", planFile)
+	if err != nil {
+		return "", err
+	}
+
+	jsonFile, err := ioutil.TempFile("", "tf-*.json")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = jsonFile.Write(planJSON)
+	if closeErr := jsonFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(jsonFile.Name())
+		return "", err
+	}
+
+	return jsonFile.Name(), nil
+}
+
+// ShowPlan returns the summary of the plan saved in planFile.
+func (r *Runner) ShowPlan(component string, planFile string) (PlanSummary, error) {
+	planJSON, err := r.Output(component, "show", "-json", planFile)
+	if err != nil {
+		return PlanSummary{}, err
+	}
+
+	if r.DryRun {
+		return PlanSummary{}, nil
+	}
+
+	return SummarizePlan(planJSON)
+}
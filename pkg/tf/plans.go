@@ -0,0 +1,66 @@
+package tf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PlansDir is the folder, relative to the root, where the plans saved with
+// "plan --out" are stored, in a folder for every component.
+const PlansDir = ".tf/plans"
+
+// PlanPath returns the path of the plan of the component saved at the given
+// time, in the plans folder of the root.
+func PlanPath(root string, component string, t time.Time) string {
+	return filepath.Join(root, PlansDir, filepath.FromSlash(component), t.UTC().Format("20060102T150405Z")+".tfplan")
+}
+
+// ListPlans returns the paths of the saved plans of the component, from the
+// oldest to the newest.
+func ListPlans(root string, component string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(root, PlansDir, filepath.FromSlash(component), "*.tfplan"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// FindPlan returns the path of a saved plan of the component: "latest" is
+// the newest one, a name is one of the plans folder of the component, and
+// anything else is the path of a plan file.
+func FindPlan(root string, component string, name string) (string, error) {
+	if name == "latest" {
+		plans, err := ListPlans(root, component)
+		if err != nil {
+			return "", err
+		}
+		if len(plans) == 0 {
+			return "", fmt.Errorf("there are no saved plans of '%s', save one with: tf plan %s --out", component, component)
+		}
+
+		return plans[len(plans)-1], nil
+	}
+
+	saved := filepath.Join(root, PlansDir, filepath.FromSlash(component), strings.TrimSuffix(name, ".tfplan")+".tfplan")
+	if _, err := os.Stat(saved); strings.ContainsAny(name, `/\`) == false && err == nil {
+		return saved, nil
+	}
+
+	// terraform runs inside the component, while the path is relative to
+	// where tf is run.
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("the plan '%s' was not found", name)
+	}
+
+	return path, nil
+}
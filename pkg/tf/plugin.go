@@ -0,0 +1,93 @@
+package tf
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// PluginPrefix is the prefix of the executables that are run for unknown
+// commands, so "tf foo" runs the "tf-foo" executable found in the PATH.
+const PluginPrefix = "tf-"
+
+// PluginComponent is a component as it is described to the plugins.
+type PluginComponent struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// PluginContext is the context that is written as JSON to the standard input
+// of the plugins.
+type PluginContext struct {
+	// Root is the directory tf was run from.
+	Root string `json:"root"`
+
+	// Component is the first argument of the command, if it is a component.
+	Component string `json:"component,omitempty"`
+
+	// Args are the arguments passed after the name of the command.
+	Args []string `json:"args"`
+
+	// Components are all the components found in Root.
+	Components []PluginComponent `json:"components"`
+}
+
+// FindPlugin returns the path of the executable implementing the command, or
+// an error if there is none in the PATH.
+func FindPlugin(command string) (string, error) {
+	return exec.LookPath(PluginPrefix + command)
+}
+
+// NewPluginContext builds the context of a plugin run from root with args.
+// If the components can't be discovered the plugin will receive an empty
+// list, since it may not need them at all.
+func NewPluginContext(root string, args []string) PluginContext {
+	ctx := PluginContext{
+		Root:       root,
+		Args:       args,
+		Components: []PluginComponent{},
+	}
+
+	if len(args) > 0 && CheckComponent(args[0]) == nil {
+		ctx.Component = NormalizeComponent(args[0])
+	}
+
+	components, err := FindProjectComponents(root)
+	if err != nil {
+		return ctx
+	}
+
+	for _, component := range components {
+		status, err := GetStatus(component)
+		if err != nil {
+			continue
+		}
+
+		ctx.Components = append(ctx.Components, PluginComponent{Name: component, Status: status})
+	}
+
+	return ctx
+}
+
+// RunPlugin runs the plugin executable with the arguments of the context.
+// The context is available to the plugin in the TF_ROOT and TF_COMPONENT
+// environment variables and as JSON in its standard input.
+func RunPlugin(plugin string, ctx PluginContext, stdout io.Writer, stderr io.Writer) error {
+	body, err := json.Marshal(ctx)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(plugin, ctx.Args...)
+	cmd.Env = append(os.Environ(), "TF_ROOT="+ctx.Root, "TF_COMPONENT="+ctx.Component)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Dir = ctx.Root
+
+	Log(LogVerbose, "running plugin", "plugin", plugin, "args", ctx.Args)
+
+	return cmd.Run()
+}
@@ -0,0 +1,56 @@
+package tf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// PolicyDir is the folder, relative to the root, with the Rego policies that
+// the plans have to pass before they are applied.
+const PolicyDir = "policy"
+
+// ConftestBinary is the executable of Conftest, which tests the plans
+// against the policies.
+const ConftestBinary = "conftest"
+
+// HasPolicies returns true if the root has a policy folder.
+func HasPolicies(root string) bool {
+	info, err := os.Stat(filepath.Join(root, PolicyDir))
+	return err == nil && info.IsDir()
+}
+
+// CheckPolicies tests the plan saved in planFile against the policies of the
+// root with "conftest test", which prints the rules that failed. It returns
+// an error if any deny rule fires.
+func (r *Runner) CheckPolicies(root string, component string, planFile string) error {
+	jsonFile, err := r.WritePlanJSON(component, planFile)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(jsonFile)
+
+	args := []string{"test", "--policy", filepath.Join(root, PolicyDir), "--no-color", jsonFile}
+	r.echoCommand(FormatCommand(ConftestBinary, args))
+	if r.DryRun {
+		return nil
+	}
+
+	cmd := exec.Command(ConftestBinary, args...)
+	cmd.Stdout = r.Stdout
+	cmd.Stderr = r.Stderr
+
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("the plan of '%s' doesn't pass the policies of the '%s' folder", component, PolicyDir)
+	}
+	if err != nil {
+		return fmt.Errorf("could not run %s: %w", ConftestBinary, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package tf
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// PrefixWriter writes every line to the underlying writer with a prefix, so
+// that the output of the components that run at the same time can be told
+// apart. The lines are written whole, holding a lock that is shared by all
+// the writers of the same output.
+type PrefixWriter struct {
+	w      io.Writer
+	prefix string
+	mu     *sync.Mutex
+
+	// partial is the last line written, until it is complete.
+	partial []byte
+}
+
+// NewPrefixWriter returns a writer that writes the lines to w with the prefix,
+// holding mu while writing.
+func NewPrefixWriter(w io.Writer, prefix string, mu *sync.Mutex) *PrefixWriter {
+	return &PrefixWriter{w: w, prefix: prefix, mu: mu}
+}
+
+// Write writes the complete lines of p, keeping the last one if it is not
+// complete yet.
+func (p *PrefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.partial = append(p.partial, b...)
+
+	for {
+		end := bytes.IndexByte(p.partial, '\n')
+		if end < 0 {
+			break
+		}
+
+		if _, err := io.WriteString(p.w, p.prefix+string(p.partial[:end+1])); err != nil {
+			return 0, err
+		}
+		p.partial = p.partial[end+1:]
+	}
+
+	return len(b), nil
+}
+
+// Flush writes the last line, even if it is not complete.
+func (p *PrefixWriter) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.partial) == 0 {
+		return nil
+	}
+
+	_, err := io.WriteString(p.w, p.prefix+string(p.partial)+"\n")
+	p.partial = nil
+
+	return err
+}
@@ -0,0 +1,135 @@
+package tf
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultRegistry is the registry of the providers whose source doesn't
+// have a hostname, and OpenTofuRegistry the one tofu uses instead.
+const (
+	DefaultRegistry  = "registry.terraform.io"
+	OpenTofuRegistry = "registry.opentofu.org"
+)
+
+// Registry returns the registry of the providers whose source doesn't have a
+// hostname when the binary runs the component: OpenTofuRegistry for tofu,
+// DefaultRegistry for anything else.
+func Registry(binary string) string {
+	if strings.TrimSuffix(filepath.Base(binary), ".exe") == "tofu" {
+		return OpenTofuRegistry
+	}
+
+	return DefaultRegistry
+}
+
+// Provider is a provider used by a component.
+type Provider struct {
+	// Source is the full address of the provider, like
+	// "registry.terraform.io/hashicorp/aws".
+	Source string
+
+	// Constraint is the version constraint of required_providers.
+	Constraint string
+
+	// Version is the version selected in the dependency lock file.
+	Version string
+}
+
+// Name returns the short name of the provider, like "aws".
+func (p Provider) Name() string {
+	return path.Base(p.Source)
+}
+
+var reProviderRequirement = regexp.MustCompile(`([\w-]+)\s*=\s*\{([^}]*)\}`)
+
+// GetProviders returns the providers of the component, from its
+// required_providers and its .terraform.lock.hcl, sorted by source. The
+// sources without a hostname are in DefaultRegistry.
+func GetProviders(component string) ([]Provider, error) {
+	return GetRegistryProviders(component, DefaultRegistry)
+}
+
+// Providers is like GetProviders, but the sources without a hostname are in
+// the registry of the binary the runner runs in the component.
+func (r *Runner) Providers(component string) ([]Provider, error) {
+	return GetRegistryProviders(component, r.registry(component))
+}
+
+// GetRegistryProviders is like GetProviders, but the sources without a
+// hostname are in the registry.
+func GetRegistryProviders(component string, registry string) ([]Provider, error) {
+	config, err := ReadConfig(component)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := map[string]*Provider{}
+
+	for _, block := range FindBlocks(config, "required_providers") {
+		for _, match := range reProviderRequirement.FindAllStringSubmatch(block.Body, -1) {
+			attributes := StringAttributes(strings.ReplaceAll(match[2], ",", "\n"))
+
+			source := NormalizeRegistrySource(match[1], registry)
+			if attributes["source"] != "" {
+				source = NormalizeRegistrySource(attributes["source"], registry)
+			}
+
+			providers[source] = &Provider{Source: source, Constraint: attributes["version"]}
+		}
+	}
+
+	lockFile, err := ioutil.ReadFile(filepath.Join(component, ".terraform.lock.hcl"))
+	if err != nil && os.IsNotExist(err) == false {
+		return nil, err
+	}
+
+	for _, block := range FindBlocks(string(lockFile), "provider") {
+		if len(block.Labels) != 1 {
+			continue
+		}
+
+		source := NormalizeRegistrySource(block.Labels[0], registry)
+		if _, ok := providers[source]; ok == false {
+			providers[source] = &Provider{Source: source}
+		}
+		providers[source].Version = StringAttributes(block.Body)["version"]
+	}
+
+	result := []Provider{}
+	for _, provider := range providers {
+		result = append(result, *provider)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Source < result[j].Source
+	})
+
+	return result, nil
+}
+
+// NormalizeProviderSource returns the full address of the provider source,
+// so "aws" and "hashicorp/aws" become "registry.terraform.io/hashicorp/aws".
+func NormalizeProviderSource(source string) string {
+	return NormalizeRegistrySource(source, DefaultRegistry)
+}
+
+// NormalizeRegistrySource is like NormalizeProviderSource, but the sources
+// without a hostname are in the registry.
+func NormalizeRegistrySource(source string, registry string) string {
+	parts := strings.Split(strings.ToLower(source), "/")
+
+	switch len(parts) {
+	case 1:
+		return path.Join(registry, "hashicorp", parts[0])
+	case 2:
+		return path.Join(registry, parts[0], parts[1])
+	default:
+		return strings.Join(parts, "/")
+	}
+}
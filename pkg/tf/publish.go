@@ -0,0 +1,215 @@
+package tf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PublishConfig says where the outputs of a component are published after
+// it is applied, so that tools that don't use terraform can read them.
+type PublishConfig struct {
+	// SSM is the prefix of the AWS SSM parameters, like "/myapp/rds".
+	SSM string `yaml:"ssm"`
+
+	// Consul is the prefix of the Consul KV keys, like "myapp/rds".
+	Consul string `yaml:"consul"`
+
+	// Outputs are the outputs to publish, all of them if it is empty.
+	Outputs []string `yaml:"outputs"`
+}
+
+// Enabled returns true if the outputs should be published somewhere.
+func (c PublishConfig) Enabled() bool {
+	return c.SSM != "" || c.Consul != ""
+}
+
+// publishedOutput is an output ready to be published.
+type publishedOutput struct {
+	Name      string
+	Value     string
+	Sensitive bool
+}
+
+// PublishOutputs publishes the outputs of the component to AWS SSM, using
+// the aws CLI, and to Consul, using the address in CONSUL_HTTP_ADDR and the
+// token in CONSUL_HTTP_TOKEN. Strings are published as they are, the other
+// values as JSON, and sensitive outputs become SecureString parameters.
+func (r *Runner) PublishOutputs(component string, config PublishConfig) error {
+	if config.Enabled() == false {
+		return nil
+	}
+
+	body, err := r.Output(component, "output", "-json")
+	if err != nil {
+		return err
+	}
+
+	outputs, err := selectOutputs(body, config.Outputs)
+	if err != nil && r.DryRun == false {
+		return err
+	}
+	if r.DryRun {
+		// There are no outputs to read in dry-run mode, "*" stands for
+		// all of them.
+		names := config.Outputs
+		if len(names) == 0 {
+			names = []string{"*"}
+		}
+
+		outputs = []publishedOutput{}
+		for _, name := range names {
+			outputs = append(outputs, publishedOutput{Name: name})
+		}
+	}
+
+	for _, output := range outputs {
+		if config.SSM != "" {
+			if err := r.publishSSM(path.Join(config.SSM, output.Name), output); err != nil {
+				return err
+			}
+		}
+
+		if config.Consul != "" {
+			if err := r.publishConsul(path.Join(config.Consul, output.Name), output); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func selectOutputs(body []byte, names []string) ([]publishedOutput, error) {
+	var outputs map[string]struct {
+		Sensitive bool            `json:"sensitive"`
+		Value     json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(body, &outputs); err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		for name := range outputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	selected := []publishedOutput{}
+
+	for _, name := range names {
+		output, ok := outputs[name]
+		if ok == false {
+			return nil, fmt.Errorf("the output '%s' doesn't exist", name)
+		}
+
+		value := string(output.Value)
+
+		var s string
+		if json.Unmarshal(output.Value, &s) == nil {
+			value = s
+		}
+
+		selected = append(selected, publishedOutput{Name: name, Value: value, Sensitive: output.Sensitive})
+	}
+
+	return selected, nil
+}
+
+// publishSSM puts the output in the SSM parameter. The value is passed to
+// the aws CLI in a temporary file that only the user can read, not in the
+// command line where anybody could see it.
+func (r *Runner) publishSSM(name string, output publishedOutput) error {
+	parameterType := "String"
+	if output.Sensitive {
+		parameterType = "SecureString"
+	}
+
+	args := []string{"ssm", "put-parameter", "--overwrite", "--name", name, "--type", parameterType, "--cli-input-json"}
+
+	r.echoCommand(FormatCommand("aws", args) + " file://***")
+	if r.DryRun {
+		return nil
+	}
+
+	input, err := writeSSMInput(output.Value)
+	if err != nil {
+		return fmt.Errorf("could not publish '%s' to SSM: %w", name, err)
+	}
+	defer os.Remove(input)
+
+	cmd := exec.Command("aws", append(args, "file://"+filepath.ToSlash(input))...)
+	cmd.Stderr = r.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("could not publish '%s' to SSM: %w", name, err)
+	}
+
+	return nil
+}
+
+// writeSSMInput writes the input of put-parameter with the value to a new
+// temporary file and returns its path.
+func writeSSMInput(value string) (string, error) {
+	body, err := json.Marshal(map[string]string{"Value": value})
+	if err != nil {
+		return "", err
+	}
+
+	file, err := ioutil.TempFile("", "tf-ssm-*.json")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = file.Write(body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+func (r *Runner) publishConsul(key string, output publishedOutput) error {
+	kvURL := consulKVURL(key)
+
+	r.echoCommand("PUT " + kvURL)
+	if r.DryRun {
+		return nil
+	}
+
+	resp, err := consulRequest(http.MethodPut, kvURL, strings.NewReader(output.Value))
+	if err != nil {
+		return fmt.Errorf("could not publish '%s' to Consul: %w", key, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not publish '%s' to Consul: %s", key, resp.Status)
+	}
+
+	return nil
+}
+
+// echoCommand prints what tf is going to do besides running terraform, in
+// the same way the terraform commands are printed in dry-run and
+// show-commands modes.
+func (r *Runner) echoCommand(line string) {
+	Log(LogVerbose, "running", "command", line)
+
+	if r.DryRun {
+		fmt.Fprintf(r.Stdout, "[dry-run] %s\n", line)
+	} else if r.ShowCommands {
+		fmt.Fprintf(r.Stderr, "+ %s\n", line)
+	}
+}
@@ -0,0 +1,430 @@
+package tf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runner runs terraform commands inside the folder of a component.
+type Runner struct {
+	// Binary is the terraform executable that is going to be run.
+	Binary string
+
+	// DryRun prints the commands that would be run to Stdout instead of
+	// running them.
+	DryRun bool
+
+	// ShowCommands prints every command to Stderr before running it.
+	ShowCommands bool
+
+	// EventPlugins are the executables that receive the events of the runs.
+	EventPlugins []string
+
+	// Components has the settings of the components from the project
+	// config, used to override the binary and to add environment variables.
+	Components map[string]ComponentConfig
+
+	// DownloadVersions downloads the terraform version required by the
+	// component when neither Binary nor the installed versions satisfy it.
+	DownloadVersions bool
+
+	// AuditRoot is the root whose AuditLog records the plans, applies and
+	// destroys. Nothing is recorded if it is empty.
+	AuditRoot string
+
+	// Audit says where else the audit log is sent.
+	Audit AuditConfig
+
+	// Locks says where else the components are locked while they are
+	// changed.
+	Locks LocksConfig
+
+	// Workspace is the terraform workspace the commands are run in, passed
+	// to terraform as TF_WORKSPACE. It is left alone if empty.
+	Workspace string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// BinaryEnv is the environment variable with the binary tf runs, like
+// "tofu" to use OpenTofu.
+const BinaryEnv = "TF_BINARY"
+
+// Binaries are the binaries tf can run, in order of preference when
+// DetectBinary looks for them.
+var Binaries = []string{"terraform", "tofu"}
+
+// DetectBinary returns the binary in TF_BINARY, or else the first of the
+// Binaries found in the PATH, or else "terraform".
+func DetectBinary() string {
+	if binary := os.Getenv(BinaryEnv); binary != "" {
+		return binary
+	}
+
+	for _, binary := range Binaries {
+		if _, err := exec.LookPath(binary); err == nil {
+			return binary
+		}
+	}
+
+	return Binaries[0]
+}
+
+// NewRunner returns a Runner that runs the DetectBinary attached to the
+// standard input and outputs of the current process, sending the events to
+// the plugins listed in TF_EVENT_PLUGINS (separated like the PATH).
+func NewRunner() *Runner {
+	return &Runner{
+		Binary:       DetectBinary(),
+		EventPlugins: filepath.SplitList(os.Getenv("TF_EVENT_PLUGINS")),
+		Stdin:        os.Stdin,
+		Stdout:       os.Stdout,
+		Stderr:       os.Stderr,
+	}
+}
+
+// ErrInterrupted is returned by Run for the commands started after tf was
+// interrupted.
+var ErrInterrupted = errors.New("tf was interrupted")
+
+// running are the terraform commands being run, which Interrupt forwards the
+// signals to. Once interrupted is set, no other command is started.
+var (
+	running     = map[*exec.Cmd]bool{}
+	runningDone sync.WaitGroup
+	interrupted bool
+	runningMu   sync.Mutex
+)
+
+// Interrupt sends the signal to the terraform commands being run, so that
+// they can stop gracefully, and makes Run fail with ErrInterrupted from then
+// on. A nil signal is not sent, when terraform already got it.
+func Interrupt(signal os.Signal) {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+
+	interrupted = true
+	if signal == nil {
+		return
+	}
+
+	for cmd := range running {
+		Log(LogVerbose, "forwarding the signal to terraform", "signal", signal, "pid", cmd.Process.Pid)
+		if err := cmd.Process.Signal(signal); err != nil {
+			Log(LogDebug, "could not forward the signal", "pid", cmd.Process.Pid, "error", err)
+		}
+	}
+}
+
+// WaitRunning waits until the terraform commands being run have finished.
+func WaitRunning() {
+	runningDone.Wait()
+}
+
+// runCommand runs the command, keeping it in running while it runs.
+func runCommand(cmd *exec.Cmd) error {
+	runningMu.Lock()
+	if interrupted {
+		runningMu.Unlock()
+		return ErrInterrupted
+	}
+	err := cmd.Start()
+	if err == nil {
+		running[cmd] = true
+		runningDone.Add(1)
+	}
+	runningMu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Wait()
+
+	runningMu.Lock()
+	delete(running, cmd)
+	runningDone.Done()
+	runningMu.Unlock()
+
+	return err
+}
+
+// Run runs terraform with the given arguments inside the component.
+func (r *Runner) Run(component string, args ...string) error {
+	return r.run(component, "", args)
+}
+
+// run is Run, but the commands that are audited are recorded as command if
+// it is not empty, like the drift checks which are plans.
+func (r *Runner) run(component string, command string, args []string) error {
+	// The outputs of other components are only needed by this command.
+	defer removeOutputsVarFiles(args)
+
+	if err := CheckComponent(component); err != nil {
+		return err
+	}
+
+	runningMu.Lock()
+	stopped := interrupted
+	runningMu.Unlock()
+	if stopped {
+		return ErrInterrupted
+	}
+
+	if r.DryRun {
+		r.printDryRun(component, args)
+		return nil
+	}
+
+	binary, err := r.binary(component)
+	if err != nil {
+		return fmt.Errorf("could not find the terraform version of '%s': %w", component, err)
+	}
+
+	if r.ShowCommands {
+		fmt.Fprintf(r.Stderr, "+ cd %s && %s\n", QuoteArg(component), FormatCommand(binary, args))
+	}
+
+	// The number of resources changed is read from the output of the
+	// commands that are audited.
+	counter := NewChangeCounter(r.Stdout)
+
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = r.Stdout
+	if IsAudited(args) && r.Stdout != nil {
+		cmd.Stdout = counter
+	}
+	cmd.Stderr = r.Stderr
+	cmd.Stdin = r.Stdin
+	cmd.Dir = component
+	cmd.Env = r.environ(component)
+
+	// The metadata is only used to enrich the events, a broken
+	// component.yaml is reported by the commands that need it.
+	metadata, _ := GetMetadata(component)
+
+	SendEvent(r.EventPlugins, Event{
+		Type:      EventRunStarted,
+		Time:      time.Now(),
+		Component: component,
+		Args:      args,
+		Owner:     metadata.Owner,
+	}, r.Stderr)
+
+	Log(LogVerbose, "running terraform", "component", component, "binary", binary, "args", args, "workspace", r.Workspace)
+
+	start := time.Now()
+	err = runCommand(cmd)
+
+	// A drift check that finds a drift exits with 2, but it succeeded.
+	success := err == nil || (command == DriftCommand && isDrift(err))
+
+	if success == false {
+		Log(LogVerbose, "terraform failed", "component", component, "command", args[0], "duration", time.Since(start), "error", err)
+	} else {
+		Log(LogVerbose, "terraform finished", "component", component, "command", args[0], "duration", time.Since(start))
+	}
+
+	if IsAudited(args) {
+		entry := NewAuditEntry(component, args, err, time.Since(start))
+		if command != "" {
+			entry.Command = command
+		}
+		entry.Workspace = r.Workspace
+		entry.Changes = counter.Changes()
+		r.audit(entry)
+	}
+
+	finished := Event{
+		Type:      EventRunFinished,
+		Time:      time.Now(),
+		Component: component,
+		Args:      args,
+		Owner:     metadata.Owner,
+		Success:   &success,
+	}
+	if err != nil {
+		finished.Error = err.Error()
+	}
+	SendEvent(r.EventPlugins, finished, r.Stderr)
+
+	return err
+}
+
+// environ returns the environment of the commands run in the component:
+// the one of tf with the env of the component and its workspace, or nil if
+// there is nothing to add to it.
+func (r *Runner) environ(component string) []string {
+	var env []string
+
+	if componentEnv := r.Components[component].Env; len(componentEnv) > 0 {
+		env = os.Environ()
+		for name, value := range componentEnv {
+			env = append(env, name+"="+value)
+		}
+	}
+	if r.Workspace != "" {
+		if env == nil {
+			env = os.Environ()
+		}
+		env = append(env, "TF_WORKSPACE="+r.Workspace)
+	}
+
+	return env
+}
+
+// Output runs terraform like Run, but it returns what terraform writes to
+// the standard output instead of writing it to Stdout. In dry-run mode the
+// command is printed to Stdout and the output is empty.
+func (r *Runner) Output(component string, args ...string) ([]byte, error) {
+	if r.DryRun {
+		return nil, r.Run(component, args...)
+	}
+
+	var out bytes.Buffer
+
+	captured := *r
+	captured.Stdout = &out
+	err := captured.Run(component, args...)
+
+	return out.Bytes(), err
+}
+
+// binary returns the terraform executable of the component: the one of its
+// settings in the project config, or else the one selected by SelectBinary
+// for its required_version, downloading it if DownloadVersions is set. In
+// dry-run mode nothing is downloaded.
+func (r *Runner) binary(component string) (string, error) {
+	if binary := r.Components[component].Binary; binary != "" {
+		Log(LogDebug, "using the binary of tf.yaml", "component", component, "binary", binary)
+		return binary, nil
+	}
+	if IsTerragrunt(component) {
+		return TerragruntBinary, nil
+	}
+
+	// The installed versions are versions of terraform, they can't replace
+	// another binary like tofu.
+	if strings.TrimSuffix(filepath.Base(r.Binary), ".exe") != "terraform" {
+		return r.Binary, nil
+	}
+
+	binary, ok, err := SelectBinary(component, r.Binary)
+	if err != nil || ok || r.DownloadVersions == false || r.DryRun {
+		// Without a matching version terraform reports the mismatch.
+		return binary, err
+	}
+
+	fmt.Fprintf(r.Stderr, "Downloading the terraform version required by '%s'...\n", component)
+	return DownloadBinary(component)
+}
+
+// printDryRun prints the command that would be run inside the component,
+// together with the names of the terraform environment variables that
+// would be passed to it, and the variables that the var file of the outputs
+// would set.
+func (r *Runner) printDryRun(component string, args []string) {
+	binary, err := r.binary(component)
+	if err != nil {
+		binary = r.Binary
+	}
+
+	fmt.Fprintf(r.Stdout, "[dry-run] in '%s': %s\n", component, FormatCommand(binary, args))
+
+	env := TerraformEnv()
+	for name := range r.Components[component].Env {
+		env = append(env, name)
+	}
+	sort.Strings(env)
+	if len(env) > 0 {
+		masked := []string{}
+		for _, name := range env {
+			masked = append(masked, name+"=***")
+		}
+		fmt.Fprintf(r.Stdout, "[dry-run]   with %s\n", strings.Join(masked, " "))
+	}
+
+	for _, arg := range args {
+		if arg != outputsVarFilePlaceholder {
+			continue
+		}
+
+		wired := r.Components[component].WiredVars()
+		names := []string{}
+		for name := range wired {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		vars := []string{}
+		for _, name := range names {
+			vars = append(vars, name+"="+wired[name])
+		}
+		fmt.Fprintf(r.Stdout, "[dry-run]   with the outputs %s in the var file\n", strings.Join(vars, " "))
+		break
+	}
+
+	if r.Workspace != "" {
+		fmt.Fprintf(r.Stdout, "[dry-run]   in the '%s' workspace\n", r.Workspace)
+	}
+}
+
+// FormatCommand returns the command line of binary with args, quoting the
+// arguments so that it can be copied and run in a shell.
+func FormatCommand(binary string, args []string) string {
+	words := []string{binary}
+
+	for _, arg := range args {
+		words = append(words, QuoteArg(arg))
+	}
+
+	return strings.Join(words, " ")
+}
+
+// QuoteArg quotes the argument if the shell would otherwise interpret it.
+func QuoteArg(arg string) string {
+	if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$`*?[]{}()<>|&;#~") {
+		return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+
+	return arg
+}
+
+// isOwnVariable returns true for the TF_ environment variables that are
+// read by tf itself, and not by terraform.
+func isOwnVariable(name string) bool {
+	switch name {
+	case BinaryEnv, VersionsDirEnv, "TF_EVENT_PLUGINS":
+		return true
+	}
+
+	return false
+}
+
+// TerraformEnv returns the sorted names of the environment variables that
+// affect terraform (the ones starting with TF_).
+func TerraformEnv() []string {
+	names := []string{}
+
+	for _, variable := range os.Environ() {
+		name := strings.SplitN(variable, "=", 2)[0]
+		if strings.HasPrefix(name, "TF_") && isOwnVariable(name) == false {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
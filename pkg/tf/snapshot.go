@@ -0,0 +1,198 @@
+package tf
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotsDir is the folder, relative to the root, where the snapshots of
+// the outputs are stored.
+const SnapshotsDir = ".tf/snapshots"
+
+// Snapshot holds the outputs of all the components at a point in time.
+type Snapshot struct {
+	Time time.Time `json:"time"`
+
+	// Outputs are the values of the outputs of every component, as JSON.
+	// Sensitive values are replaced by their hash so that they are not
+	// written to disk, but their changes can still be detected.
+	Outputs map[string]map[string]string `json:"outputs"`
+}
+
+// OutputChange is an output whose value is different between two snapshots.
+// Old is empty for new outputs and New is empty for removed ones.
+type OutputChange struct {
+	Component string
+	Output    string
+	Old       string
+	New       string
+}
+
+// TakeSnapshot reads the outputs of the components. The components whose
+// outputs can't be read are returned in failed, and are not part of the
+// snapshot.
+func (r *Runner) TakeSnapshot(components []string) (snapshot Snapshot, failed []string) {
+	snapshot = Snapshot{Time: time.Now().UTC(), Outputs: map[string]map[string]string{}}
+
+	for _, component := range components {
+		body, err := r.Output(component, "output", "-json")
+		if err != nil {
+			failed = append(failed, component)
+			continue
+		}
+
+		if r.DryRun {
+			continue
+		}
+
+		outputs, err := snapshotOutputs(body)
+		if err != nil {
+			failed = append(failed, component)
+			continue
+		}
+
+		snapshot.Outputs[component] = outputs
+	}
+
+	return snapshot, failed
+}
+
+func snapshotOutputs(body []byte) (map[string]string, error) {
+	var outputs map[string]struct {
+		Sensitive bool        `json:"sensitive"`
+		Value     interface{} `json:"value"`
+	}
+	if err := json.Unmarshal(body, &outputs); err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+
+	for name, output := range outputs {
+		// Marshalling the decoded value sorts the keys of the objects, so
+		// the same value is always written the same way.
+		value, err := json.Marshal(output.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		if output.Sensitive {
+			value = []byte(fmt.Sprintf("(sensitive sha256:%x)", sha256.Sum256(value)))
+		}
+
+		values[name] = string(value)
+	}
+
+	return values, nil
+}
+
+// SaveSnapshot writes the snapshot in the snapshots folder of the root and
+// returns its name.
+func SaveSnapshot(root string, snapshot Snapshot) (string, error) {
+	dir := filepath.Join(root, SnapshotsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	body, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	name := snapshot.Time.Format("20060102T150405Z")
+
+	return name, ioutil.WriteFile(filepath.Join(dir, name+".json"), append(body, '\n'), 0600)
+}
+
+// ListSnapshots returns the names of the snapshots of the root, from the
+// oldest to the newest.
+func ListSnapshots(root string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(root, SnapshotsDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, file := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(file), ".json"))
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// LoadSnapshot reads the snapshot with the given name, where "latest" is the
+// newest snapshot.
+func LoadSnapshot(root string, name string) (Snapshot, error) {
+	if name == "latest" {
+		names, err := ListSnapshots(root)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		if len(names) == 0 {
+			return Snapshot{}, fmt.Errorf("there are no snapshots in '%s'", filepath.Join(root, SnapshotsDir))
+		}
+		name = names[len(names)-1]
+	}
+
+	body, err := ioutil.ReadFile(filepath.Join(root, SnapshotsDir, strings.TrimSuffix(name, ".json")+".json"))
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(body, &snapshot); err != nil {
+		return Snapshot{}, fmt.Errorf("could not unmarshal the snapshot '%s': %w", name, err)
+	}
+
+	return snapshot, nil
+}
+
+// DiffSnapshots returns the outputs that changed from old to new, sorted by
+// component and output.
+func DiffSnapshots(old Snapshot, new Snapshot) []OutputChange {
+	changes := []OutputChange{}
+
+	components := map[string]bool{}
+	for component := range old.Outputs {
+		components[component] = true
+	}
+	for component := range new.Outputs {
+		components[component] = true
+	}
+
+	for component := range components {
+		outputs := map[string]bool{}
+		for output := range old.Outputs[component] {
+			outputs[output] = true
+		}
+		for output := range new.Outputs[component] {
+			outputs[output] = true
+		}
+
+		for output := range outputs {
+			oldValue := old.Outputs[component][output]
+			newValue := new.Outputs[component][output]
+
+			if oldValue != newValue {
+				changes = append(changes, OutputChange{Component: component, Output: output, Old: oldValue, New: newValue})
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Component != changes[j].Component {
+			return changes[i].Component < changes[j].Component
+		}
+		return changes[i].Output < changes[j].Output
+	})
+
+	return changes
+}
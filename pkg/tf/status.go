@@ -0,0 +1,321 @@
+package tf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+const (
+	StatusApplied   = "applied"
+	StatusDestroyed = "destroyed"
+
+	// DefaultWorkspace is the workspace of the components that don't use
+	// environments.
+	DefaultWorkspace = "default"
+
+	// StatusUnknown is the status of the components with a remote backend
+	// whose state could not be pulled, usually because "terraform init"
+	// was not run yet.
+	StatusUnknown = "unknown"
+)
+
+// ErrStatePull is returned when the state of a component with a remote
+// backend could not be pulled.
+var ErrStatePull = errors.New("could not pull the state")
+
+// State is the part of a terraform.tfstate that tf cares about.
+type State struct {
+	Resources []struct {
+		Mode      string            `json:"mode"`
+		Type      string            `json:"type"`
+		Provider  string            `json:"provider"`
+		Instances []json.RawMessage `json:"instances"`
+	} `json:"resources"`
+}
+
+// ReadState reads the state of the component, returning nil if the
+// component doesn't have one. The state of the local backend is read from
+// its file, the state of the other backends is pulled with "terraform state
+// pull".
+func ReadState(component string) (*State, error) {
+	return ReadWorkspaceState(component, DefaultWorkspace)
+}
+
+// ReadWorkspaceState is like ReadState, but it reads the state of one of the
+// workspaces of the component.
+func ReadWorkspaceState(component string, workspace string) (*State, error) {
+	return NewRunner().ReadWorkspaceState(component, workspace)
+}
+
+// ReadWorkspaceState is like the ReadWorkspaceState function, but the state
+// of the remote backends is pulled with the binary the runner runs in the
+// component.
+func (r *Runner) ReadWorkspaceState(component string, workspace string) (*State, error) {
+	backend, err := GetBackend(component)
+	if err != nil {
+		return nil, err
+	}
+
+	// The backend of terragrunt components is in their terragrunt.hcl (or
+	// in the one they include), so it is always pulled.
+	var body []byte
+	if backend.Type == BackendLocal && IsTerragrunt(component) == false {
+		body, err = readLocalState(component, backend, workspace)
+	} else {
+		body, err = r.pullState(component, workspace)
+	}
+	if err != nil || len(bytes.TrimSpace(body)) == 0 {
+		return nil, err
+	}
+
+	var s State
+	err = json.Unmarshal(body, &s)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal the state of component '%s': %w", component, err)
+	}
+
+	return &s, nil
+}
+
+// readLocalState returns the content of the state file of the local
+// backend, which is terraform.tfstate unless the backend sets a path. The
+// other workspaces keep their state in terraform.tfstate.d.
+func readLocalState(component string, backend Backend, workspace string) ([]byte, error) {
+	body, err := ioutil.ReadFile(localStatePath(component, backend, workspace))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read the %s of component '%s': %w", backend.Location(), component, err)
+	}
+
+	return body, nil
+}
+
+// localStatePath returns the path of the state file of the workspace of the
+// component with the local backend. The path and the workspace_dir of the
+// backend are relative to the component, unless they are absolute.
+func localStatePath(component string, backend Backend, workspace string) string {
+	if workspace == DefaultWorkspace {
+		return inComponent(component, backend.Location())
+	}
+
+	workspaceDir := backend.Config["workspace_dir"]
+	if workspaceDir == "" {
+		workspaceDir = "terraform.tfstate.d"
+	}
+
+	return filepath.Join(inComponent(component, workspaceDir), workspace, path.Base(backend.Location()))
+}
+
+// inComponent returns the path relative to the component, or the path
+// itself if it is absolute.
+func inComponent(component string, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+
+	return filepath.Join(component, p)
+}
+
+// pullState returns the state of a component with a remote backend. It
+// doesn't go through Run because reading the state is not a run: it is never
+// skipped by --dry-run and it doesn't send events.
+func (r *Runner) pullState(component string, workspace string) ([]byte, error) {
+	var stderr bytes.Buffer
+
+	// The state can only be read by a terraform at least as recent as the
+	// one that wrote it, so it is the binary of the runner, but nothing is
+	// downloaded just to read the state.
+	noDownload := *r
+	noDownload.DownloadVersions = false
+	binary, err := noDownload.binary(component)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(binary, "state", "pull")
+	cmd.Dir = component
+	cmd.Env = append(os.Environ(), "TF_WORKSPACE="+workspace)
+	cmd.Stderr = &stderr
+
+	body, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w of component '%s': %s", ErrStatePull, component, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return body, nil
+}
+
+// GetStatus returns StatusDestroyed or StatusApplied depending on the status
+// of the component, or StatusUnknown if its remote state could not be
+// pulled.
+func GetStatus(component string) (string, error) {
+	return GetWorkspaceStatus(component, DefaultWorkspace)
+}
+
+// GetWorkspaceStatus is like GetStatus, but for one of the workspaces of the
+// component.
+func GetWorkspaceStatus(component string, workspace string) (string, error) {
+	return NewRunner().GetWorkspaceStatus(component, workspace)
+}
+
+// GetWorkspaceStatus is like the GetWorkspaceStatus function, but it reads the
+// state with the runner (see Runner.ReadWorkspaceState).
+func (r *Runner) GetWorkspaceStatus(component string, workspace string) (string, error) {
+	s, err := r.ReadWorkspaceState(component, workspace)
+	if errors.Is(err, ErrStatePull) {
+		return StatusUnknown, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return s.Status(), nil
+}
+
+// Status returns StatusApplied if the state has resources, or
+// StatusDestroyed if it doesn't or if it is nil.
+func (s *State) Status() string {
+	if s == nil || len(s.Resources) == 0 {
+		return StatusDestroyed
+	}
+
+	return StatusApplied
+}
+
+// CountResources returns the number of resource instances managed by the
+// component, the same ones listed by "terraform state list" without the data
+// sources.
+func CountResources(component string) (int, error) {
+	return CountWorkspaceResources(component, DefaultWorkspace)
+}
+
+// CountWorkspaceResources is like CountResources, but for one of the
+// workspaces of the component.
+func CountWorkspaceResources(component string, workspace string) (int, error) {
+	return NewRunner().CountWorkspaceResources(component, workspace)
+}
+
+// CountWorkspaceResources is like the CountWorkspaceResources function, but
+// it reads the state with the runner.
+func (r *Runner) CountWorkspaceResources(component string, workspace string) (int, error) {
+	s, err := r.ReadWorkspaceState(component, workspace)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.CountResources(), nil
+}
+
+// CountResources returns the number of resource instances in the state,
+// without the data sources. A nil state has none.
+func (s *State) CountResources() int {
+	if s == nil {
+		return 0
+	}
+
+	count := 0
+	for _, resource := range s.Resources {
+		if resource.Mode == "managed" {
+			count += len(resource.Instances)
+		}
+	}
+
+	return count
+}
+
+var reStateProvider = regexp.MustCompile(`provider\["([^"]+)"\]`)
+
+// CountWorkspaceResourcesByProvider is like CountWorkspaceResources, but it
+// returns the number of resources of every provider, by its short name like
+// "aws". The resources of the aliases of a provider count for the provider.
+func CountWorkspaceResourcesByProvider(component string, workspace string) (map[string]int, error) {
+	return NewRunner().CountWorkspaceResourcesByProvider(component, workspace)
+}
+
+// CountWorkspaceResourcesByProvider is like the
+// CountWorkspaceResourcesByProvider function, but it reads the state with the
+// runner.
+func (r *Runner) CountWorkspaceResourcesByProvider(component string, workspace string) (map[string]int, error) {
+	s, err := r.ReadWorkspaceState(component, workspace)
+	if err != nil {
+		return map[string]int{}, err
+	}
+
+	return s.CountResourcesByProvider(), nil
+}
+
+// CountResourcesByProvider is like CountResources, but it returns the number
+// of resources of every provider, by its short name like "aws".
+func (s *State) CountResourcesByProvider() map[string]int {
+	counts := map[string]int{}
+	if s == nil {
+		return counts
+	}
+
+	for _, resource := range s.Resources {
+		if resource.Mode != "managed" {
+			continue
+		}
+
+		provider := resource.Provider
+		if match := reStateProvider.FindStringSubmatch(provider); match != nil {
+			provider = Provider{Source: match[1]}.Name()
+		}
+		counts[provider] += len(resource.Instances)
+	}
+
+	return counts
+}
+
+// LastApplied returns when the state of the workspace of the component last
+// changed: the modification time of its state file with the local backend,
+// or else the time of its last successful apply or destroy in the audit log
+// of the root. It is zero if it is not known.
+func LastApplied(root string, component string, workspace string) (time.Time, error) {
+	backend, err := GetBackend(component)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if backend.Type == BackendLocal && IsTerragrunt(component) == false {
+		stat, err := os.Stat(localStatePath(component, backend, workspace))
+		if os.IsNotExist(err) {
+			return time.Time{}, nil
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		return stat.ModTime(), nil
+	}
+
+	entries, err := ReadAuditLog(root)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var last time.Time
+	for _, entry := range entries {
+		entryWorkspace := entry.Workspace
+		if entryWorkspace == "" {
+			entryWorkspace = DefaultWorkspace
+		}
+
+		if entry.Component == component && entryWorkspace == workspace && entry.ExitCode == 0 && (entry.Command == "apply" || entry.Command == "destroy") {
+			last = entry.Time
+		}
+	}
+
+	return last, nil
+}
@@ -0,0 +1,128 @@
+package tf
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// defaultTestTimeout is how long a smoke test can run if it doesn't set its
+// own timeout.
+const defaultTestTimeout = 5 * time.Minute
+
+// SmokeTest is a command that is run in the component after it is applied
+// (and after its health checks) to test that it works end to end.
+type SmokeTest struct {
+	Name    string        `yaml:"name"`
+	Command string        `yaml:"command"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// TestsCommand is the command of the smoke tests in the audit log.
+const TestsCommand = "tests"
+
+// TestResult is the result of a smoke test, as it is sent in the events, the
+// notifications and the audit log.
+type TestResult struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Duration time.Duration `json:"duration_ns"`
+
+	// Output is what the test printed, only kept when it fails.
+	Output string `json:"output,omitempty"`
+}
+
+// RunTests runs the smoke tests of the component one after the other,
+// sending their results to the event plugins in an EventTestsFinished event
+// and recording them in the audit log.
+func (r *Runner) RunTests(component string, tests []SmokeTest) []TestResult {
+	results := []TestResult{}
+	start := time.Now()
+
+	for _, test := range tests {
+		name := test.Name
+		if name == "" {
+			name = test.Command
+		}
+
+		r.echoCommand(fmt.Sprintf("cd %s && %s", QuoteArg(component), test.Command))
+		if r.DryRun {
+			continue
+		}
+
+		timeout := test.Timeout
+		if timeout == 0 {
+			timeout = defaultTestTimeout
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		cmd := ShellCommand(ctx, test.Command)
+		cmd.Dir = component
+
+		testStart := time.Now()
+		out, err := cmd.CombinedOutput()
+		cancel()
+
+		result := TestResult{Name: name, Passed: err == nil, Duration: time.Since(testStart)}
+		if err != nil {
+			result.Output = fmt.Sprintf("%s%s", out, err)
+		}
+
+		results = append(results, result)
+	}
+
+	if len(results) > 0 {
+		metadata, _ := GetMetadata(component)
+
+		SendEvent(r.EventPlugins, Event{
+			Type:      EventTestsFinished,
+			Time:      time.Now(),
+			Component: component,
+			Args:      []string{},
+			Owner:     metadata.Owner,
+			Tests:     results,
+		}, r.Stderr)
+
+		r.audit(newTestsAuditEntry(component, r.Workspace, results, time.Since(start)))
+	}
+
+	return results
+}
+
+// newTestsAuditEntry returns the entry of the smoke tests of the component,
+// whose args are the names of the tests. It exits with 1 if any test failed.
+func newTestsAuditEntry(component string, workspace string, results []TestResult, duration time.Duration) AuditEntry {
+	entry := AuditEntry{
+		Time:      time.Now().UTC(),
+		Component: component,
+		Workspace: workspace,
+		User:      currentUser(),
+		Command:   TestsCommand,
+		Args:      []string{},
+		Duration:  duration.Seconds(),
+		Tests:     results,
+	}
+	entry.Host, _ = os.Hostname()
+
+	for _, result := range results {
+		entry.Args = append(entry.Args, result.Name)
+		if result.Passed == false {
+			entry.ExitCode = 1
+		}
+	}
+
+	return entry
+}
+
+// CountPassed returns the number of tests that passed.
+func CountPassed(results []TestResult) int {
+	passed := 0
+	for _, result := range results {
+		if result.Passed {
+			passed++
+		}
+	}
+
+	return passed
+}
@@ -0,0 +1,28 @@
+package tf
+
+import (
+	"fmt"
+)
+
+// Validate runs "terraform validate" in the component. If initialize is true
+// and the component has to be initialized (see Runner.InitReason), it is
+// first initialized without its backend, since validating doesn't need the
+// state.
+func (r *Runner) Validate(component string, initialize bool) error {
+	if initialize {
+		reason, err := r.InitReason(component)
+		if err != nil {
+			return err
+		}
+
+		if reason != "" {
+			fmt.Fprintf(r.Stderr, "Initializing '%s' without its backend because %s.\n", component, reason)
+
+			if err := r.Run(component, "init", "-input=false", "-backend=false"); err != nil {
+				return fmt.Errorf("terraform init failed: %w", err)
+			}
+		}
+	}
+
+	return r.Run(component, "validate")
+}
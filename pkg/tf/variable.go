@@ -0,0 +1,98 @@
+package tf
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Variable is an input variable declared by a component.
+type Variable struct {
+	Name        string
+	Type        string
+	Description string
+
+	// Default is the default value as it is written in the configuration,
+	// it is empty if the variable is required.
+	Default string
+
+	Sensitive bool
+}
+
+// Output is an output value declared by a component.
+type Output struct {
+	Name        string
+	Description string
+	Sensitive   bool
+}
+
+// GetVariables returns the variables declared by the component, sorted by
+// name.
+func GetVariables(component string) ([]Variable, error) {
+	config, err := ReadConfig(component)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := []Variable{}
+
+	for _, block := range FindBlocks(config, "variable") {
+		if len(block.Labels) != 1 {
+			continue
+		}
+
+		attributes := Attributes(block.Body)
+		variables = append(variables, Variable{
+			Name:        block.Labels[0],
+			Type:        attributes["type"],
+			Description: unquote(attributes["description"]),
+			Default:     attributes["default"],
+			Sensitive:   attributes["sensitive"] == "true",
+		})
+	}
+
+	sort.Slice(variables, func(i, j int) bool {
+		return variables[i].Name < variables[j].Name
+	})
+
+	return variables, nil
+}
+
+// GetOutputs returns the outputs declared by the component, sorted by name.
+// Use Runner.Output with "output" to get their values.
+func GetOutputs(component string) ([]Output, error) {
+	config, err := ReadConfig(component)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := []Output{}
+
+	for _, block := range FindBlocks(config, "output") {
+		if len(block.Labels) != 1 {
+			continue
+		}
+
+		attributes := Attributes(block.Body)
+		outputs = append(outputs, Output{
+			Name:        block.Labels[0],
+			Description: unquote(attributes["description"]),
+			Sensitive:   attributes["sensitive"] == "true",
+		})
+	}
+
+	sort.Slice(outputs, func(i, j int) bool {
+		return outputs[i].Name < outputs[j].Name
+	})
+
+	return outputs, nil
+}
+
+// unquote returns the value of a string literal, or the expression itself if
+// it isn't one.
+func unquote(expression string) string {
+	if value, err := strconv.Unquote(expression); err == nil {
+		return value
+	}
+
+	return expression
+}
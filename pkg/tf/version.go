@@ -0,0 +1,165 @@
+package tf
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	reVersion    = regexp.MustCompile(`v?(\d+(?:\.\d+)*)(?:-([0-9A-Za-z.-]+))?`)
+	reConstraint = regexp.MustCompile(`^\s*(=|!=|>=|<=|>|<|~>)?\s*(\S+)\s*$`)
+)
+
+// RequiredVersion returns the required_version constraint of the terraform
+// block of the component, or an empty string if there is none.
+func RequiredVersion(component string) (string, error) {
+	config, err := ReadConfig(component)
+	if err != nil {
+		return "", err
+	}
+
+	for _, block := range FindBlocks(config, "terraform") {
+		if constraint, ok := StringAttributes(block.Body)["required_version"]; ok {
+			return constraint, nil
+		}
+	}
+
+	return "", nil
+}
+
+// BinaryVersion returns the version of the terraform binary, like "1.5.7".
+func BinaryVersion(binary string) (string, error) {
+	out, err := exec.Command(binary, "version").Output()
+	if err != nil {
+		return "", err
+	}
+
+	firstLine := strings.SplitN(string(out), "\n", 2)[0]
+
+	match := reVersion.FindString(firstLine)
+	if match == "" {
+		return "", fmt.Errorf("could not find the version in '%s'", firstLine)
+	}
+
+	return strings.TrimPrefix(match, "v"), nil
+}
+
+// VersionSatisfies returns true if the version satisfies the constraint,
+// using the same syntax as terraform's required_version.
+func VersionSatisfies(version string, constraint string) (bool, error) {
+	v, err := parseVersion(version)
+	if err != nil {
+		return false, err
+	}
+
+	for _, part := range strings.Split(constraint, ",") {
+		match := reConstraint.FindStringSubmatch(part)
+		if match == nil {
+			return false, fmt.Errorf("invalid version constraint '%s'", part)
+		}
+
+		c, err := parseVersion(match[2])
+		if err != nil {
+			return false, err
+		}
+
+		cmp := compareVersions(v, c)
+
+		ok := false
+		switch match[1] {
+		case "", "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case "~>":
+			ok = cmp >= 0 && compareVersions(v, pessimisticLimit(c)) < 0
+		}
+
+		if ok == false {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+type version struct {
+	segments   []int
+	prerelease string
+}
+
+func parseVersion(s string) (version, error) {
+	match := reVersion.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil || match[0] != strings.TrimSpace(s) {
+		return version{}, fmt.Errorf("invalid version '%s'", s)
+	}
+
+	v := version{prerelease: match[2]}
+	for _, segment := range strings.Split(match[1], ".") {
+		n, err := strconv.Atoi(segment)
+		if err != nil {
+			return version{}, fmt.Errorf("invalid version '%s'", s)
+		}
+		v.segments = append(v.segments, n)
+	}
+
+	return v, nil
+}
+
+// compareVersions returns -1, 0 or 1 if a is lower, equal or greater than b.
+// Missing segments count as zero and a prerelease is lower than its release.
+func compareVersions(a version, b version) int {
+	for i := 0; i < len(a.segments) || i < len(b.segments); i++ {
+		x, y := 0, 0
+		if i < len(a.segments) {
+			x = a.segments[i]
+		}
+		if i < len(b.segments) {
+			y = b.segments[i]
+		}
+
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case a.prerelease == b.prerelease:
+		return 0
+	case a.prerelease == "":
+		return 1
+	case b.prerelease == "":
+		return -1
+	case a.prerelease < b.prerelease:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// pessimisticLimit returns the first version excluded by "~> v", so "~> 1.2"
+// allows versions lower than 2.0 and "~> 1.2.3" lower than 1.3.0.
+func pessimisticLimit(v version) version {
+	if len(v.segments) == 1 {
+		return version{segments: []int{v.segments[0] + 1}}
+	}
+
+	limit := append([]int{}, v.segments[:len(v.segments)-1]...)
+	limit[len(limit)-1]++
+
+	return version{segments: limit}
+}
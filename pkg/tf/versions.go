@@ -0,0 +1,379 @@
+package tf
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VersionsDirEnv is the environment variable that overrides the directory
+// where the terraform versions are installed.
+const VersionsDirEnv = "TF_VERSIONS_DIR"
+
+// ReleasesURL is where the terraform releases are downloaded from.
+var ReleasesURL = "https://releases.hashicorp.com/terraform"
+
+// releasesClient downloads the releases. Its timeout covers the whole
+// download, so it leaves time for the archives of a slow connection, but a
+// server that stops answering doesn't block tf forever.
+var releasesClient = &http.Client{Timeout: 5 * time.Minute}
+
+var (
+	// binaryVersions caches the version of every binary, since running
+	// "terraform version" for every command would be slow.
+	binaryVersions   = map[string]string{}
+	binaryVersionsMu sync.Mutex
+
+	// installMu makes sure that a version is not installed twice at the
+	// same time.
+	installMu sync.Mutex
+)
+
+// VersionsDir returns the directory where the terraform versions are
+// installed, each one in a directory named like the version:
+// ~/.tf/versions/1.5.7/terraform.
+func VersionsDir() (string, error) {
+	if dir := os.Getenv(VersionsDirEnv); dir != "" {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".tf", "versions"), nil
+}
+
+// VersionBinary returns the path of the terraform binary of the version.
+func VersionBinary(version string) (string, error) {
+	dir, err := VersionsDir()
+	if err != nil {
+		return "", err
+	}
+
+	binary := "terraform"
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+
+	return filepath.Join(dir, version, binary), nil
+}
+
+// InstalledVersions returns the terraform versions installed in the
+// VersionsDir.
+func InstalledVersions() ([]string, error) {
+	dir, err := VersionsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []string{}
+	for _, entry := range entries {
+		binary, err := VersionBinary(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := os.Stat(binary); err == nil {
+			versions = append(versions, entry.Name())
+		}
+	}
+
+	return versions, nil
+}
+
+// BestVersion returns the highest of the versions that satisfies the
+// constraint, ignoring the prereleases, or an empty string if none does.
+func BestVersion(versions []string, constraint string) string {
+	best := ""
+	var bestVersion version
+
+	for _, name := range versions {
+		v, err := parseVersion(name)
+		if err != nil || v.prerelease != "" {
+			continue
+		}
+
+		if ok, err := VersionSatisfies(name, constraint); err != nil || ok == false {
+			continue
+		}
+
+		if best == "" || compareVersions(v, bestVersion) > 0 {
+			best, bestVersion = name, v
+		}
+	}
+
+	return best
+}
+
+// ReleasedVersions returns all the versions of terraform that can be
+// downloaded.
+func ReleasedVersions() ([]string, error) {
+	resp, err := releasesClient.Get(ReleasesURL + "/index.json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not list the terraform releases: %s", resp.Status)
+	}
+
+	var index struct {
+		Versions map[string]json.RawMessage `json:"versions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, fmt.Errorf("could not read the terraform releases: %w", err)
+	}
+
+	versions := []string{}
+	for name := range index.Versions {
+		versions = append(versions, name)
+	}
+
+	return versions, nil
+}
+
+// InstallVersion downloads the version of terraform for this platform into
+// the VersionsDir, returning the path of its binary. The archive is only
+// extracted if its SHA-256 matches the one of the SHA256SUMS of the release.
+// It does nothing if the version is already installed.
+func InstallVersion(version string) (string, error) {
+	installMu.Lock()
+	defer installMu.Unlock()
+
+	binary, err := VersionBinary(version)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(binary); err == nil {
+		return binary, nil
+	}
+
+	name := fmt.Sprintf("terraform_%s_%s_%s.zip", version, runtime.GOOS, runtime.GOARCH)
+	url := fmt.Sprintf("%s/%s/%s", ReleasesURL, version, name)
+
+	sum, err := releaseSum(version, name)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := releasesClient.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not download %s: %s", url, resp.Status)
+	}
+
+	// zip needs to seek, so the archive is saved first.
+	archive, err := ioutil.TempFile("", "terraform-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(archive, hash), resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("could not download %s: %w", url, err)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != sum {
+		return "", fmt.Errorf("the SHA-256 of %s doesn't match the one of its release, the download is corrupted or was tampered with", url)
+	}
+
+	reader, err := zip.NewReader(archive, size)
+	if err != nil {
+		return "", fmt.Errorf("could not open %s: %w", url, err)
+	}
+
+	for _, file := range reader.File {
+		if file.Name != filepath.Base(binary) {
+			continue
+		}
+
+		if err := extractFile(file, binary); err != nil {
+			return "", err
+		}
+		return binary, nil
+	}
+
+	return "", fmt.Errorf("there is no %s in %s", filepath.Base(binary), url)
+}
+
+// releaseSum returns the SHA-256 of the file of the release of the version,
+// from the SHA256SUMS of the release.
+func releaseSum(version string, name string) (string, error) {
+	url := fmt.Sprintf("%s/%s/terraform_%s_SHA256SUMS", ReleasesURL, version, version)
+
+	resp, err := releasesClient.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not download %s: %s", url, resp.Status)
+	}
+
+	// Every line is the hash and the name of a file, separated by spaces.
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("could not download %s: %w", url, err)
+	}
+
+	return "", fmt.Errorf("there is no %s in %s", name, url)
+}
+
+// extractFile extracts the file of a zip archive to path, as an executable.
+func extractFile(file *zip.File, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// The binary is written with another name and renamed at the end, so
+	// that a failed download doesn't leave a broken version installed.
+	tmp := path + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// cachedBinaryVersion is BinaryVersion, but it runs the binary only once.
+func cachedBinaryVersion(binary string) (string, error) {
+	binaryVersionsMu.Lock()
+	defer binaryVersionsMu.Unlock()
+
+	if v, ok := binaryVersions[binary]; ok {
+		return v, nil
+	}
+
+	v, err := BinaryVersion(binary)
+	if err != nil {
+		return "", err
+	}
+	binaryVersions[binary] = v
+
+	return v, nil
+}
+
+// ComponentVersion returns the terraform binary that runs in the component,
+// like Run picks it but without downloading anything, and its version. For
+// the terragrunt components it is the binary of the runner, which terragrunt
+// runs. The version is empty if the binary could not be run.
+func (r *Runner) ComponentVersion(component string) (string, string, error) {
+	noDownload := *r
+	noDownload.DownloadVersions = false
+
+	binary, err := noDownload.binary(component)
+	if err != nil {
+		return "", "", err
+	}
+	if IsTerragrunt(component) {
+		binary = r.Binary
+	}
+
+	// A binary that can't be run has no version.
+	version, _ := cachedBinaryVersion(binary)
+
+	return binary, version, nil
+}
+
+// SelectBinary returns the terraform binary to use for the component: the
+// default binary if it satisfies the required_version of the component, or
+// else the highest installed version that does. If none of them does, it
+// returns the default binary and false.
+func SelectBinary(component string, defaultBinary string) (string, bool, error) {
+	constraint, err := RequiredVersion(component)
+	if err != nil || constraint == "" {
+		// A broken configuration is reported by terraform itself.
+		return defaultBinary, true, nil
+	}
+
+	if v, err := cachedBinaryVersion(defaultBinary); err == nil {
+		if ok, _ := VersionSatisfies(v, constraint); ok {
+			return defaultBinary, true, nil
+		}
+	}
+
+	installed, err := InstalledVersions()
+	if err != nil {
+		return "", false, err
+	}
+	if v := BestVersion(installed, constraint); v != "" {
+		binary, err := VersionBinary(v)
+		return binary, true, err
+	}
+
+	return defaultBinary, false, nil
+}
+
+// DownloadBinary installs the highest released version of terraform that
+// satisfies the required_version of the component, returning its binary.
+func DownloadBinary(component string) (string, error) {
+	constraint, err := RequiredVersion(component)
+	if err != nil {
+		return "", err
+	}
+
+	released, err := ReleasedVersions()
+	if err != nil {
+		return "", err
+	}
+
+	v := BestVersion(released, constraint)
+	if v == "" {
+		return "", fmt.Errorf("no terraform release satisfies the required_version '%s'", constraint)
+	}
+
+	return InstallVersion(v)
+}
@@ -0,0 +1,134 @@
+package tf
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// serveRelease serves a release of terraform with the archive of this
+// platform, and the SHA256SUMS with sum for it (its real SHA-256 if empty).
+func serveRelease(t *testing.T, version string, sum string) {
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	file, err := writer.Create(filepath.Base(mustVersionBinary(t, version)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("#!/bin/sh\n"))
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := fmt.Sprintf("terraform_%s_%s_%s.zip", version, runtime.GOOS, runtime.GOARCH)
+	if sum == "" {
+		sum = fmt.Sprintf("%x", sha256.Sum256(archive.Bytes()))
+	}
+	sums := fmt.Sprintf("%x  terraform_%s_other_arch.zip\n%s  %s\n", sha256.Sum256(nil), version, sum, name)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + version + "/" + name:
+			w.Write(archive.Bytes())
+		case "/" + version + "/terraform_" + version + "_SHA256SUMS":
+			w.Write([]byte(sums))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	releasesURL := ReleasesURL
+	ReleasesURL = server.URL
+	t.Cleanup(func() { ReleasesURL = releasesURL })
+}
+
+func mustVersionBinary(t *testing.T, version string) string {
+	binary, err := VersionBinary(version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return binary
+}
+
+func TestInstallVersion(t *testing.T) {
+	os.Setenv(VersionsDirEnv, t.TempDir())
+	defer os.Unsetenv(VersionsDirEnv)
+
+	serveRelease(t, "1.5.7", "")
+
+	binary, err := InstallVersion("1.5.7")
+	if err != nil {
+		t.Fatalf("InstallVersion failed: %s", err)
+	}
+	if body, err := ioutil.ReadFile(binary); err != nil || string(body) != "#!/bin/sh\n" {
+		t.Errorf("InstallVersion extracted %q (%v)", body, err)
+	}
+}
+
+func TestInstallVersionWrongSum(t *testing.T) {
+	os.Setenv(VersionsDirEnv, t.TempDir())
+	defer os.Unsetenv(VersionsDirEnv)
+
+	serveRelease(t, "1.5.7", fmt.Sprintf("%x", sha256.Sum256([]byte("something else"))))
+
+	_, err := InstallVersion("1.5.7")
+	if err == nil || strings.Contains(err.Error(), "doesn't match") == false {
+		t.Fatalf("InstallVersion should fail because of the checksum, it returned %v", err)
+	}
+	if _, err := os.Stat(mustVersionBinary(t, "1.5.7")); os.IsNotExist(err) == false {
+		t.Errorf("InstallVersion installed a binary whose checksum doesn't match")
+	}
+}
+
+func TestComponentVersion(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake terraform is a shell script")
+	}
+
+	dir := t.TempDir()
+	fake := func(name string, version string) string {
+		binary := filepath.Join(dir, name)
+		script := "#!/bin/sh\necho 'Terraform v" + version + "'\n"
+		if err := ioutil.WriteFile(binary, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return binary
+	}
+
+	runner := &Runner{
+		Binary: fake("terraform", "1.3.9"),
+		Components: map[string]ComponentConfig{
+			"app": {Binary: fake("terraform-1.5", "1.5.7")},
+		},
+	}
+
+	tests := []struct {
+		component   string
+		wantBinary  string
+		wantVersion string
+	}{
+		{filepath.Join(dir, "network"), runner.Binary, "1.3.9"},
+		{"app", filepath.Join(dir, "terraform-1.5"), "1.5.7"},
+	}
+
+	for _, test := range tests {
+		binary, version, err := runner.ComponentVersion(test.component)
+		if err != nil {
+			t.Fatalf("ComponentVersion(%q) failed: %s", test.component, err)
+		}
+		if binary != test.wantBinary || version != test.wantVersion {
+			t.Errorf("ComponentVersion(%q) returned %s %s, want %s %s", test.component, binary, version, test.wantBinary, test.wantVersion)
+		}
+	}
+}
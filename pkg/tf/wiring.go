@@ -0,0 +1,272 @@
+package tf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// outputRefPattern matches the references to the outputs of other
+// components, like ${network/vpc.vpc_id}. The output is after the last dot.
+var outputRefPattern = regexp.MustCompile(`\$\{([^}]+)\.([^.}]+)\}`)
+
+// OutputRef is a reference to an output of another component in the value of
+// a variable of the project config.
+type OutputRef struct {
+	Component string
+	Output    string
+}
+
+// String returns the reference as it is written in the config.
+func (r OutputRef) String() string {
+	return "${" + r.Component + "." + r.Output + "}"
+}
+
+// ParseOutputRefs returns the references to outputs in the value.
+func ParseOutputRefs(value string) []OutputRef {
+	refs := []OutputRef{}
+
+	for _, match := range outputRefPattern.FindAllStringSubmatch(value, -1) {
+		refs = append(refs, OutputRef{Component: NormalizeComponent(match[1]), Output: match[2]})
+	}
+
+	return refs
+}
+
+// OutputRefs returns the references to outputs in the variables of the
+// component.
+func (c ComponentConfig) OutputRefs() []OutputRef {
+	refs := []OutputRef{}
+	for _, value := range c.Vars {
+		refs = append(refs, ParseOutputRefs(value)...)
+	}
+
+	return refs
+}
+
+// WiredVars returns the variables of the component whose values use the
+// outputs of other components.
+func (c ComponentConfig) WiredVars() map[string]string {
+	wired := map[string]string{}
+	for name, value := range c.Vars {
+		if len(ParseOutputRefs(value)) > 0 {
+			wired[name] = value
+		}
+	}
+
+	return wired
+}
+
+// Dependencies returns the components that have to be applied before this
+// one: the ones in its depends_on, and the ones whose outputs its variables
+// use. They are sorted.
+func (c ComponentConfig) Dependencies() []string {
+	dependencies := append([]string{}, c.DependsOn...)
+
+	for _, ref := range c.OutputRefs() {
+		found := false
+		for _, dependency := range dependencies {
+			if dependency == ref.Component {
+				found = true
+				break
+			}
+		}
+		if found == false {
+			dependencies = append(dependencies, ref.Component)
+		}
+	}
+	sort.Strings(dependencies)
+
+	return dependencies
+}
+
+// outputsVarFilePlaceholder stands for the var file of the outputs in the
+// commands printed in dry-run mode, where the outputs are not read.
+var outputsVarFilePlaceholder = filepath.Join(os.TempDir(), "tf-outputs-*.tfvars.json")
+
+// ComponentVarArgs returns the -var and -var-file arguments for the default
+// variables of the component, like ComponentConfig.VarArgs. The variables
+// that use the outputs of other components are not passed with -var, since
+// their values can be secrets that would be shown in the command line: they
+// are written to a temporary var file, readable only by the user, which is
+// passed last so that they keep the precedence of -var. Run removes the file
+// once the command that uses it finishes. In dry-run mode the outputs are
+// not read, and a placeholder is passed instead of the file.
+func (r *Runner) ComponentVarArgs(component string) ([]string, error) {
+	config := r.Components[component]
+
+	wiredVars := config.WiredVars()
+	if len(wiredVars) == 0 {
+		return config.VarArgs(), nil
+	}
+
+	plain := ComponentConfig{VarFiles: config.VarFiles, Vars: map[string]string{}}
+	for name, value := range config.Vars {
+		if _, ok := wiredVars[name]; ok == false {
+			plain.Vars[name] = value
+		}
+	}
+
+	if r.DryRun {
+		return append(plain.VarArgs(), "-var-file", outputsVarFilePlaceholder), nil
+	}
+
+	// Every producer is read once, even if many variables use it.
+	outputs := map[string]map[string]json.RawMessage{}
+
+	wired := map[string]json.RawMessage{}
+	for name, value := range wiredVars {
+		resolved, err := r.resolveOutputRefs(component, name, value, outputs)
+		if err != nil {
+			return nil, err
+		}
+		wired[name] = resolved
+	}
+
+	varFile, err := writeOutputsVarFile(wired)
+	if err != nil {
+		return nil, fmt.Errorf("could not write the outputs used by the variables of '%s': %w", component, err)
+	}
+
+	return append(plain.VarArgs(), "-var-file", varFile), nil
+}
+
+// resolveOutputRefs returns the value of the variable with the references
+// to outputs replaced by their values, as JSON. A value that is only a
+// reference gets the value of the output as it is, so that lists and maps
+// keep their type; otherwise the outputs are put in a string, as they are
+// if they are strings and as JSON if not.
+func (r *Runner) resolveOutputRefs(component string, name string, value string, outputs map[string]map[string]json.RawMessage) (json.RawMessage, error) {
+	var err error
+	var whole json.RawMessage
+
+	resolved := outputRefPattern.ReplaceAllStringFunc(value, func(match string) string {
+		if err != nil {
+			return match
+		}
+
+		ref := ParseOutputRefs(match)[0]
+
+		if _, ok := outputs[ref.Component]; ok == false {
+			outputs[ref.Component], err = r.readOutputs(ref.Component)
+			if err != nil {
+				err = fmt.Errorf("could not read the outputs of '%s', used by the variable '%s' of '%s': %w", ref.Component, name, component, err)
+				return match
+			}
+		}
+
+		output, ok := outputs[ref.Component][ref.Output]
+		if ok == false {
+			err = fmt.Errorf("the variable '%s' of '%s' uses %s, but '%s' has no output '%s'", name, component, ref, ref.Component, ref.Output)
+			return match
+		}
+		if match == value {
+			whole = output
+		}
+
+		var s string
+		if json.Unmarshal(output, &s) == nil {
+			return s
+		}
+
+		return string(output)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if whole != nil {
+		return whole, nil
+	}
+
+	return json.Marshal(resolved)
+}
+
+// outputsVarFiles are the var files written by ComponentVarArgs that were
+// not removed yet.
+var (
+	outputsVarFiles   = map[string]bool{}
+	outputsVarFilesMu sync.Mutex
+)
+
+// writeOutputsVarFile writes the variables to a new temporary .tfvars.json
+// file, which only the user can read, and returns its path.
+func writeOutputsVarFile(vars map[string]json.RawMessage) (string, error) {
+	body, err := json.MarshalIndent(vars, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	file, err := ioutil.TempFile("", "tf-outputs-*.tfvars.json")
+	if err != nil {
+		return "", err
+	}
+
+	outputsVarFilesMu.Lock()
+	outputsVarFiles[file.Name()] = true
+	outputsVarFilesMu.Unlock()
+
+	_, err = file.Write(body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removeOutputsVarFiles([]string{file.Name()})
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// removeOutputsVarFiles removes the var files written by ComponentVarArgs
+// that are in args.
+func removeOutputsVarFiles(args []string) {
+	outputsVarFilesMu.Lock()
+	defer outputsVarFilesMu.Unlock()
+
+	for _, arg := range args {
+		if outputsVarFiles[arg] {
+			os.Remove(arg)
+			delete(outputsVarFiles, arg)
+		}
+	}
+}
+
+// RemoveOutputsVarFiles removes the var files written by ComponentVarArgs
+// that were never passed to Run, for when tf exits early.
+func RemoveOutputsVarFiles() {
+	outputsVarFilesMu.Lock()
+	files := []string{}
+	for file := range outputsVarFiles {
+		files = append(files, file)
+	}
+	outputsVarFilesMu.Unlock()
+
+	removeOutputsVarFiles(files)
+}
+
+// readOutputs returns the values of the outputs of the component, as JSON.
+func (r *Runner) readOutputs(component string) (map[string]json.RawMessage, error) {
+	body, err := r.Output(component, "output", "-json")
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs map[string]struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(body, &outputs); err != nil {
+		return nil, err
+	}
+
+	values := map[string]json.RawMessage{}
+	for name, output := range outputs {
+		values[name] = output.Value
+	}
+
+	return values, nil
+}
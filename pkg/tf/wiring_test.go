@@ -0,0 +1,160 @@
+package tf
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// wiringRunner returns a Runner for a network component whose outputs are
+// printed by a fake terraform, and an app component that uses them. It
+// changes to a new directory with both components.
+func wiringRunner(t *testing.T, vars map[string]string) *Runner {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake terraform is a shell script")
+	}
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	for _, component := range []string{"network", "app"} {
+		if err := os.Mkdir(component, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fake := filepath.Join(dir, "terraform")
+	script := "#!/bin/sh\necho '{\"vpc_id\": {\"value\": \"vpc-123\"}, \"subnets\": {\"value\": [\"a\", \"b\"]}}'\n"
+	if err := ioutil.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Runner{
+		Binary: fake,
+		Components: map[string]ComponentConfig{
+			"network": {Binary: fake},
+			"app":     {Binary: fake, VarFiles: []string{"../common.tfvars"}, Vars: vars},
+		},
+		Stdout: ioutil.Discard,
+		Stderr: ioutil.Discard,
+	}
+}
+
+func TestComponentVarArgs(t *testing.T) {
+	runner := wiringRunner(t, map[string]string{
+		"region":  "eu-west-1",
+		"vpc_id":  "${network.vpc_id}",
+		"subnets": "${network.subnets}",
+		"name":    "app-${network.vpc_id}",
+	})
+
+	args, err := runner.ComponentVarArgs("app")
+	if err != nil {
+		t.Fatalf("ComponentVarArgs failed: %s", err)
+	}
+
+	// The outputs are passed last, so that like the -var they win over
+	// the var files of the component.
+	if len(args) != 6 {
+		t.Fatalf("ComponentVarArgs returned %q, want the var file, the variable and the outputs", args)
+	}
+	want := []string{"-var-file", "../common.tfvars", "-var", "region=eu-west-1", "-var-file"}
+	if reflect.DeepEqual(args[:5], want) == false {
+		t.Errorf("ComponentVarArgs returned %q, want it to start with %q", args, want)
+	}
+
+	varFile := args[5]
+	if strings.Contains(strings.Join(args, " "), "vpc-123") {
+		t.Errorf("ComponentVarArgs returned %q, with the value of an output", args)
+	}
+
+	stat, err := os.Stat(varFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm() != 0600 {
+		t.Errorf("the var file of the outputs has mode %s, want -rw-------", stat.Mode().Perm())
+	}
+
+	body, err := ioutil.ReadFile(varFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(body, &values); err != nil {
+		t.Fatal(err)
+	}
+	wantValues := map[string]interface{}{
+		"vpc_id":  "vpc-123",
+		"subnets": []interface{}{"a", "b"},
+		"name":    "app-vpc-123",
+	}
+	if reflect.DeepEqual(values, wantValues) == false {
+		t.Errorf("the var file of the outputs has %v, want %v", values, wantValues)
+	}
+
+	if err := runner.Run("app", append([]string{"plan"}, args...)...); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if _, err := os.Stat(varFile); os.IsNotExist(err) == false {
+		t.Errorf("the var file of the outputs was not removed by Run")
+	}
+}
+
+func TestComponentVarArgsMissingOutput(t *testing.T) {
+	runner := wiringRunner(t, map[string]string{"zone_id": "${network.zone_id}"})
+
+	_, err := runner.ComponentVarArgs("app")
+	if err == nil || strings.Contains(err.Error(), "has no output 'zone_id'") == false {
+		t.Errorf("ComponentVarArgs returned %v, want the missing output", err)
+	}
+
+	outputsVarFilesMu.Lock()
+	defer outputsVarFilesMu.Unlock()
+	if len(outputsVarFiles) > 0 {
+		t.Errorf("ComponentVarArgs left the var files %v", outputsVarFiles)
+	}
+}
+
+func TestComponentVarArgsDryRun(t *testing.T) {
+	runner := wiringRunner(t, map[string]string{
+		"region": "eu-west-1",
+		"vpc_id": "${network.vpc_id}",
+		"name":   "app-${network.vpc_id}",
+	})
+	var stdout strings.Builder
+	runner.Stdout = &stdout
+	runner.DryRun = true
+
+	args, err := runner.ComponentVarArgs("app")
+	if err != nil {
+		t.Fatalf("ComponentVarArgs failed: %s", err)
+	}
+
+	// Like the real invocation, the outputs are in a var file and not in
+	// a -var.
+	want := []string{"-var-file", "../common.tfvars", "-var", "region=eu-west-1", "-var-file", outputsVarFilePlaceholder}
+	if reflect.DeepEqual(args, want) == false {
+		t.Errorf("ComponentVarArgs returned %q, want %q", args, want)
+	}
+
+	if err := runner.Run("app", append([]string{"plan"}, args...)...); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	wantLine := "[dry-run]   with the outputs name=app-${network.vpc_id} vpc_id=${network.vpc_id} in the var file\n"
+	if strings.Contains(stdout.String(), wantLine) == false {
+		t.Errorf("the dry-run printed %q, without %q", stdout.String(), wantLine)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// CmdPlan is run for the "plan" command.
+func CmdPlan(args []string) {
+	fs := NewFlagSet("plan")
+	AddEnvFlag(fs)
+	detail := fs.Bool("detail", false, "Show the full output of terraform instead of the summary of the plan")
+	save := fs.Bool("out", false, "Save the plan in "+tf.PlansDir+", to apply it later with apply --plan")
+	format := fs.String("format", "", "Output format: github-comment")
+	AddParallelFlag(fs)
+	AddInitFlag(fs)
+	AddVarFlags(fs)
+	positional, terraformArgs := ParseFlagsWithTerraformArgs(fs, args)
+
+	if *format != "" {
+		CheckFormat(*format, PlanFormats)
+		if *detail {
+			Error("--detail can't be used with --format, the comment only has the summary of the plan")
+		}
+	}
+
+	var comment io.Writer
+	if *format == FormatGitHubComment {
+		comment = CommentOutput()
+	}
+
+	if len(positional) > 0 && tf.IsPattern(positional[0]) {
+		if *save {
+			Error("--out can only be used to plan a single component")
+		}
+
+		order := PatternGraph(positional[0]).Order()
+		PrintComponents(fmt.Sprintf("These components match '%s' and will be planned", positional[0]), order)
+
+		PlanComponents(order, comment, terraformArgs)
+		return
+	}
+
+	component := ComponentArg(positional)
+
+	runner := NewRunner()
+
+	planFile := ""
+	if *save {
+		planFile = SavedPlanPath(runner, component)
+	}
+
+	var summary tf.PlanSummary
+
+	err := WithHooks(runner, component, func() error {
+		if err := EnsureInit(runner, component); err != nil {
+			return fmt.Errorf("Could not initialize '%s': %w", component, err)
+		}
+
+		if *detail {
+			tfArgs := []string{"plan"}
+			if planFile != "" {
+				tfArgs = append(tfArgs, "-out="+planFile)
+			}
+
+			varArgs, err := VarArgsE(runner, component, terraformArgs)
+			if err != nil {
+				return err
+			}
+
+			return runner.Run(component, append(tfArgs, varArgs...)...)
+		}
+
+		// The output of terraform is only shown if the plan fails. Since
+		// it is hidden, terraform can't ask for the missing variables.
+		quiet := *runner
+		var out bytes.Buffer
+		if runner.DryRun == false {
+			quiet.Stdout = &out
+		}
+
+		varArgs, err := VarArgsE(runner, component, terraformArgs)
+		if err != nil {
+			return err
+		}
+		planArgs := append([]string{"-input=false"}, varArgs...)
+
+		if planFile != "" {
+			err = quiet.SavePlanFile(component, planFile, planArgs...)
+		} else {
+			planFile, err = quiet.SavePlan(component, planArgs...)
+			defer os.Remove(planFile)
+		}
+		if err != nil {
+			os.Stdout.Write(out.Bytes())
+			return err
+		}
+
+		summary, err = runner.ShowPlan(component, planFile)
+		if err != nil {
+			return fmt.Errorf("Could not read the plan of '%s': %s", component, err)
+		}
+
+		return nil
+	})
+
+	if comment != nil && runner.DryRun == false {
+		result := tf.RunResult{Component: component, Result: tf.ResultOK, Changes: &summary}
+		if err != nil {
+			result.Result = tf.ResultFailed
+			result.Err = err
+		}
+		WriteGitHubComment(comment, []tf.RunResult{result})
+	}
+	ExitOnError(err)
+
+	if runner.DryRun {
+		return
+	}
+
+	if *detail == false && *format == "" {
+		if summary.HasChanges() == false {
+			fmt.Printf("No changes in '%s'.\n", component)
+		} else {
+			PrintPlanSummary(os.Stdout, component, summary)
+		}
+	}
+
+	if *save {
+		PrintSavedPlan(runner, component, planFile)
+	}
+}
+
+// SavedPlanPath returns the path where "plan --out" saves the plan of the
+// component, creating its folder.
+func SavedPlanPath(runner *tf.Runner, component string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		InternalError("Could not find the current working directory", err)
+	}
+
+	planFile := tf.PlanPath(wd, component, time.Now())
+	if runner.DryRun {
+		return planFile
+	}
+
+	if err := os.MkdirAll(filepath.Dir(planFile), 0755); err != nil {
+		InternalError("Could not create the folder of the plans", err)
+	}
+
+	return planFile
+}
+
+// PrintSavedPlan tells the user where the plan was saved, and how to apply
+// it, if it was.
+func PrintSavedPlan(runner *tf.Runner, component string, planFile string) {
+	if planFile == "" || runner.DryRun {
+		return
+	}
+
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, planFile); err == nil {
+			planFile = filepath.ToSlash(rel)
+		}
+	}
+
+	fmt.Printf("\nSaved the plan in '%s', apply it with: tf apply %s --plan latest\n", planFile, component)
+}
+
+// PrintPlanSummary prints how many resources the plan of the component would
+// add, change and destroy, followed by their addresses.
+func PrintPlanSummary(w io.Writer, component string, summary tf.PlanSummary) {
+	fmt.Fprintf(w, "Summary of '%s': %s.\n", component, summary)
+	for _, address := range summary.Add {
+		fmt.Fprintf(w, "  + %s\n", address)
+	}
+	for _, address := range summary.Change {
+		fmt.Fprintf(w, "  ~ %s\n", address)
+	}
+	for _, address := range summary.Destroy {
+		fmt.Fprintf(w, "  - %s\n", address)
+	}
+}
+
+// CmdPlanAll is run for the "plan-all" command.
+func CmdPlanAll(args []string) {
+	fs := NewFlagSet("plan-all")
+	AddEnvFlag(fs)
+	format := fs.String("format", "", "Output format: github-comment")
+	AddParallelFlag(fs)
+	AddInitFlag(fs)
+	AddVarFlags(fs)
+	_, terraformArgs := ParseFlagsWithTerraformArgs(fs, args)
+
+	var comment io.Writer
+	if *format != "" {
+		CheckFormat(*format, PlanFormats)
+		comment = CommentOutput()
+	}
+
+	wd, components := FindComponents()
+	PlanComponents(LoadGraph(wd, components).Order(), comment, terraformArgs)
+}
+
+// PlanComponents plans the components one after the other (or --parallel of
+// them at the same time) and summarizes their changes, passing terraformArgs
+// to every plan. The GitHub comment of the plans is written to comment, if it
+// is not nil. It exits with an error after the summary if any of the plans
+// failed.
+func PlanComponents(order []string, comment io.Writer, terraformArgs []string) {
+	runner := NewRunner()
+	changes := map[string]tf.PlanSummary{}
+	var mu sync.Mutex
+
+	noBlockers := func(string) []string { return nil }
+
+	results := RunComponents(runner, "Planning", order, noBlockers, func(runner *tf.Runner, component string) error {
+		return WithHooks(runner, component, func() error {
+			if err := EnsureInit(runner, component); err != nil {
+				return err
+			}
+
+			varArgs, err := VarArgsE(runner, component, terraformArgs)
+			if err != nil {
+				return err
+			}
+
+			planFile, err := runner.SavePlan(component, varArgs...)
+			if err != nil {
+				return err
+			}
+			defer os.Remove(planFile)
+
+			summary, err := runner.ShowPlan(component, planFile)
+			if err != nil {
+				return fmt.Errorf("could not read the plan: %w", err)
+			}
+
+			mu.Lock()
+			changes[component] = summary
+			mu.Unlock()
+
+			return nil
+		})
+	})
+
+	changed := 0
+	for i, result := range results {
+		if summary, ok := changes[result.Component]; ok && runner.DryRun == false {
+			results[i].Changes = &summary
+			if summary.HasChanges() {
+				changed++
+			}
+		}
+	}
+
+	ok := PrintSummary(results)
+
+	if runner.DryRun == false {
+		fmt.Printf("\n%d of %d components have changes.\n", changed, len(results))
+	}
+
+	if comment != nil && runner.DryRun == false {
+		WriteGitHubComment(comment, results)
+	}
+
+	if ok == false {
+		os.Exit(1)
+	}
+}
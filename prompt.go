@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// confirm is how the commands ask for confirmation. tf ui replaces it, since
+// it reads keys instead of lines.
+var confirm = Confirm
+
+// Confirm asks the question to the user, returning true only if they answer
+// "yes" like terraform requires.
+func Confirm(question string) bool {
+	fmt.Printf("%s\n  Only 'yes' will be accepted to confirm.\n\n  Enter a value: ", question)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Println()
+		return false
+	}
+
+	return strings.TrimSpace(answer) == "yes"
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// TokenEnv is the environment variable with the token the clients of
+// "tf serve" have to send, when --token is not passed.
+const TokenEnv = "TF_SERVE_TOKEN"
+
+// JobCommands are the commands that can be run as jobs by "tf serve".
+var JobCommands = []string{"plan", "apply", "drift"}
+
+// These are the statuses of a job.
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// MaxJobs is the number of finished jobs the server keeps, the oldest ones are
+// removed first. MaxJobOutput is the number of bytes of the output of a job
+// it keeps, the end of the output is kept.
+const (
+	MaxJobs      = 100
+	MaxJobOutput = 1 << 20
+)
+
+// Job is a plan, an apply or a drift check of a component run in the
+// background by the server. Like the events, fields are only ever added to
+// it, never removed or renamed.
+type Job struct {
+	ID        int        `json:"id"`
+	Command   string     `json:"command"`
+	Component string     `json:"component"`
+	Status    string     `json:"status"`
+	Started   time.Time  `json:"started"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	Error     string     `json:"error,omitempty"`
+
+	// Drifted is only set by the drift checks that succeeded.
+	Drifted *bool `json:"drifted,omitempty"`
+
+	// Output is the output of terraform, only returned by /jobs/<id>.
+	Output string `json:"output,omitempty"`
+
+	output []byte
+}
+
+// Server is the HTTP API of "tf serve", that lists the components of the
+// directory it was started in, reads their status, runs their plans,
+// applies and drift checks in the background and exports their Metrics.
+type Server struct {
+	wd      string
+	token   string
+	metrics *Metrics
+
+	jobs   []*Job
+	nextID int
+	mu     sync.Mutex
+}
+
+// CmdServe is run for the "serve" command.
+func CmdServe(args []string) {
+	fs := NewFlagSet("serve")
+	listen := fs.String("listen", "localhost:8080", "Address the server listens on, like :8080 for every interface")
+	token := fs.String("token", os.Getenv(TokenEnv), "Token the clients have to send as 'Authorization: Bearer <token>' (default: $"+TokenEnv+")")
+	AddParallelFlag(fs)
+	ParseFlags(fs, args)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		InternalError("Could not find the current working directory", err)
+	}
+
+	if *token == "" {
+		fmt.Fprintf(os.Stderr, "Warning: there is no --token, anybody who can reach %s can apply the components\n", *listen)
+	}
+
+	server := &Server{wd: wd, token: *token, metrics: NewMetrics()}
+
+	fmt.Printf("Listening on %s\n", *listen)
+	if err := http.ListenAndServe(*listen, server); err != nil {
+		Error(fmt.Sprintf("Could not listen on %s: %s", *listen, err))
+	}
+}
+
+// ServeHTTP serves the endpoints of the API:
+//
+//	GET  /components  the names of the components
+//	GET  /status      the status of the components, like tf status --format json
+//	GET  /jobs        the jobs, newest first
+//	POST /jobs        run {"command": "plan", "apply" or "drift", "component": "..."}
+//	GET  /jobs/<id>   the job with its output
+//	GET  /metrics     the metrics of the jobs, for Prometheus
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tf.Log(tf.LogVerbose, "request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+
+	if s.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) != 1 {
+		respondError(w, http.StatusUnauthorized, "missing or wrong token")
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/components" && r.Method == http.MethodGet:
+		s.listComponents(w)
+	case r.URL.Path == "/status" && r.Method == http.MethodGet:
+		s.status(w)
+	case r.URL.Path == "/jobs" && r.Method == http.MethodGet:
+		s.listJobs(w)
+	case r.URL.Path == "/jobs" && r.Method == http.MethodPost:
+		s.startJob(w, r)
+	case strings.HasPrefix(r.URL.Path, "/jobs/") && r.Method == http.MethodGet:
+		s.getJob(w, strings.TrimPrefix(r.URL.Path, "/jobs/"))
+	case r.URL.Path == "/metrics" && r.Method == http.MethodGet:
+		s.writeMetrics(w)
+	case r.URL.Path == "/components" || r.URL.Path == "/status" || r.URL.Path == "/jobs" || strings.HasPrefix(r.URL.Path, "/jobs/") || r.URL.Path == "/metrics":
+		respondError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%s is not allowed on %s", r.Method, r.URL.Path))
+	default:
+		respondError(w, http.StatusNotFound, fmt.Sprintf("%s not found", r.URL.Path))
+	}
+}
+
+// components returns the components of the directory of the server and its
+// config. Unlike FindComponents, the errors are returned instead of exiting.
+func (s *Server) components() ([]string, tf.Config, error) {
+	config, err := tf.LoadConfig(s.wd)
+	if err != nil {
+		return nil, config, err
+	}
+
+	components, err := config.FindComponents(s.wd)
+	return components, config, err
+}
+
+func (s *Server) listComponents(w http.ResponseWriter) {
+	components, _, err := s.components()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, components)
+}
+
+func (s *Server) status(w http.ResponseWriter) {
+	components, config, err := s.components()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	columns := ParseStatusColumns(strings.Replace(DefaultMachineStatusColumns, "name,", "name,env,", 1))
+	header := []string{}
+	for _, column := range columns {
+		header = append(header, column.Name)
+	}
+
+	names := []string{}
+	workspaces := []string{}
+	for _, component := range components {
+		for _, workspace := range config.Components[component].Workspaces() {
+			names = append(names, component)
+			workspaces = append(workspaces, workspace)
+		}
+	}
+
+	runner, err := NewRunnerE()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rows := make([][]string, len(names))
+	errs := make([]error, len(names))
+	tf.ParallelEach(names, parallel, func(i int, component string) {
+		row := &StatusRow{Runner: runner, Component: component, Workspace: workspaces[i]}
+
+		for _, column := range columns {
+			value, err := column.Value(row)
+			if err != nil {
+				errs[i] = fmt.Errorf("could not get the %s of '%s': %w", column.Name, component, err)
+				return
+			}
+
+			rows[i] = append(rows[i], value)
+		}
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := WriteRows(w, FormatJSON, header, rows); err != nil {
+		tf.Log(tf.LogVerbose, "could not write the status", "error", err)
+	}
+}
+
+func (s *Server) writeMetrics(w http.ResponseWriter) {
+	components, _, err := s.components()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := s.metrics.Write(w, components); err != nil {
+		tf.Log(tf.LogVerbose, "could not write the metrics", "error", err)
+	}
+}
+
+func (s *Server) listJobs(w http.ResponseWriter) {
+	s.mu.Lock()
+	jobs := []Job{}
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, s.jobs[i].snapshot(false))
+	}
+	s.mu.Unlock()
+
+	respondJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) getJob(w http.ResponseWriter, id string) {
+	n, err := strconv.Atoi(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if err == nil && job.ID == n {
+			respondJSON(w, http.StatusOK, job.snapshot(true))
+			return
+		}
+	}
+
+	respondError(w, http.StatusNotFound, fmt.Sprintf("job '%s' not found", id))
+}
+
+func (s *Server) startJob(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Command   string `json:"command"`
+		Component string `json:"component"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid job: %s", err))
+		return
+	}
+
+	if contains(JobCommands, request.Command) == false {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("unknown command '%s', it should be one of: %s", request.Command, strings.Join(JobCommands, ", ")))
+		return
+	}
+
+	// Only the components that were found can be run, not any folder.
+	components, _, err := s.components()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	component := tf.NormalizeComponent(request.Component)
+	if contains(components, component) == false {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("component '%s' not found", request.Component))
+		return
+	}
+
+	s.mu.Lock()
+	for _, job := range s.jobs {
+		if job.Component == component && job.Status == JobRunning {
+			s.mu.Unlock()
+			respondError(w, http.StatusConflict, fmt.Sprintf("the %s of '%s' is already running as job %d", job.Command, component, job.ID))
+			return
+		}
+	}
+	s.nextID++
+	job := &Job{ID: s.nextID, Command: request.Command, Component: component, Status: JobRunning, Started: time.Now().UTC()}
+	s.jobs = append(s.jobs, job)
+	response := job.snapshot(false)
+	s.mu.Unlock()
+
+	tf.Log(tf.LogVerbose, "job started", "id", job.ID, "command", job.Command, "component", component)
+	go s.run(job)
+
+	respondJSON(w, http.StatusAccepted, response)
+}
+
+// run runs the job, without input and without colors in the output. The
+// applies don't ask for confirmation, since nobody could answer.
+//
+// Nothing run by a job can exit, since that would stop the server and release
+// the locks of the other jobs: the errors are reported in the job instead.
+func (s *Server) run(job *Job) {
+	var drifted *bool
+
+	err := s.runJob(job, &drifted)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	finished := time.Now().UTC()
+	job.Finished = &finished
+	job.Status = JobSucceeded
+	job.Drifted = drifted
+	if err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+	}
+	s.evictJobs()
+
+	s.metrics.RecordJob(job.Command, job.Status)
+	tf.Log(tf.LogVerbose, "job finished", "id", job.ID, "status", job.Status, "duration", finished.Sub(job.Started))
+}
+
+// runJob runs the command of the job, setting drifted for the drift checks.
+func (s *Server) runJob(job *Job, drifted **bool) error {
+	runner, err := NewRunnerE()
+	if err != nil {
+		return err
+	}
+	runner.Stdin = nil
+	runner.Stdout = &jobOutput{server: s, job: job}
+	runner.Stderr = runner.Stdout
+
+	terraformArgs := []string{"-input=false", "-no-color"}
+
+	if job.Command == "apply" {
+		review, err := UsePoliciesE()
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		err = ApplyComponent(runner, job.Component, true, review, terraformArgs)
+		s.metrics.RecordApply(job.Component, time.Since(start), err)
+		return err
+	}
+
+	if job.Command == "drift" {
+		drift, err := CheckDrift(runner, job.Component, []string{"-no-color"})
+		if err == nil {
+			*drifted = &drift
+			s.metrics.RecordDrift(job.Component, drift)
+		}
+		return err
+	}
+
+	return WithHooks(runner, job.Component, func() error {
+		err := EnsureInit(runner, job.Component)
+		if err != nil {
+			return err
+		}
+
+		varArgs, err := VarArgsE(runner, job.Component, terraformArgs)
+		if err != nil {
+			return err
+		}
+
+		return runner.Run(job.Component, append([]string{"plan"}, varArgs...)...)
+	})
+}
+
+// evictJobs removes the oldest finished jobs when there are more than
+// MaxJobs, so that the server doesn't keep all of them forever. The running
+// jobs are never removed. It has to be called with the lock of the server.
+func (s *Server) evictJobs() {
+	finished := 0
+	for _, job := range s.jobs {
+		if job.Status != JobRunning {
+			finished++
+		}
+	}
+
+	kept := []*Job{}
+	for _, job := range s.jobs {
+		if job.Status != JobRunning && finished > MaxJobs {
+			finished--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	s.jobs = kept
+}
+
+// jobOutput is the writer of the output of a job, which is read by the
+// requests while the job is running.
+type jobOutput struct {
+	server *Server
+	job    *Job
+}
+
+// Write appends p to the output of the job, dropping the beginning of the
+// output when it is longer than MaxJobOutput.
+func (o *jobOutput) Write(p []byte) (int, error) {
+	o.server.mu.Lock()
+	defer o.server.mu.Unlock()
+
+	o.job.output = append(o.job.output, p...)
+	if len(o.job.output) > MaxJobOutput {
+		o.job.output = append([]byte{}, o.job.output[len(o.job.output)-MaxJobOutput:]...)
+	}
+
+	return len(p), nil
+}
+
+// snapshot returns a copy of the job, with its output if withOutput is true.
+// It has to be called with the lock of the server.
+func (j *Job) snapshot(withOutput bool) Job {
+	job := Job{ID: j.ID, Command: j.Command, Component: j.Component, Status: j.Status, Started: j.Started, Finished: j.Finished, Error: j.Error, Drifted: j.Drifted}
+	if withOutput {
+		job.Output = string(j.output)
+	}
+
+	return job
+}
+
+func respondJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		tf.Log(tf.LogVerbose, "could not write the response", "error", err)
+	}
+}
+
+func respondError(w http.ResponseWriter, status int, message string) {
+	respondJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+)
+
+// stateChanges are the "terraform state" subcommands that change the state,
+// so the component is locked while they run.
+var stateChanges = []string{"mv", "rm", "push", "replace-provider"}
+
+// CmdState is run for the "state" command.
+func CmdState(args []string) {
+	fs := NewFlagSet("state")
+	AddEnvFlag(fs)
+	AddInitFlag(fs)
+	positional, terraformArgs := ParseFlagsWithTerraformArgs(fs, args)
+
+	component := ComponentArg(positional)
+
+	stateArgs := append(positional[1:], terraformArgs...)
+	if len(stateArgs) == 0 {
+		Error(fmt.Sprintf("Missing the state subcommand, like in: tf state %s list", component))
+	}
+
+	runner := NewRunner()
+	if err := EnsureInit(runner, component); err != nil {
+		Error(fmt.Sprintf("Could not initialize '%s': %s", component, err))
+	}
+
+	unlock := func() {}
+	if contains(stateChanges, stateArgs[0]) {
+		var err error
+		unlock, err = LockComponent(runner, component, "state "+stateArgs[0])
+		if err != nil {
+			Error(err.Error())
+		}
+	}
+
+	err := runner.Run(component, append([]string{"state"}, stateArgs...)...)
+	unlock()
+	ExitOnError(err)
+}
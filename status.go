@@ -0,0 +1,523 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// StatusColumn is a column that can be shown by the status command.
+type StatusColumn struct {
+	Name string
+
+	// Value returns the value of the column for the row.
+	Value func(row *StatusRow) (string, error)
+}
+
+// StatusRow is a workspace of a component shown by the status command. Its
+// state is read at most once, by the first column that needs it, since the
+// remote states are pulled with terraform.
+type StatusRow struct {
+	// Runner is the runner of the command, so that the state is read with
+	// the binary it runs.
+	Runner    *tf.Runner
+	Component string
+	Workspace string
+
+	state     *tf.State
+	stateErr  error
+	stateRead bool
+}
+
+// State returns the state of the workspace of the component.
+func (r *StatusRow) State() (*tf.State, error) {
+	if r.stateRead == false {
+		r.state, r.stateErr = r.Runner.ReadWorkspaceState(r.Component, r.Workspace)
+		r.stateRead = true
+	}
+
+	return r.state, r.stateErr
+}
+
+// Status returns the status of the workspace of the component, like
+// GetWorkspaceStatus.
+func (r *StatusRow) Status() (string, error) {
+	state, err := r.State()
+	if errors.Is(err, tf.ErrStatePull) {
+		return tf.StatusUnknown, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return state.Status(), nil
+}
+
+// componentValue returns a Value for the columns that are the same in every
+// workspace of the component.
+func componentValue(value func(component string) (string, error)) func(*StatusRow) (string, error) {
+	return func(row *StatusRow) (string, error) {
+		return value(row.Component)
+	}
+}
+
+// runnerValue returns a Value for the columns that are the same in every
+// workspace of the component, but depend on the binary of the runner.
+func runnerValue(value func(runner *tf.Runner, component string) (string, error)) func(*StatusRow) (string, error) {
+	return func(row *StatusRow) (string, error) {
+		return value(row.Runner, row.Component)
+	}
+}
+
+// StatusColumns are all the columns that can be selected with --columns.
+var StatusColumns = []StatusColumn{
+	{
+		Name: "name",
+		Value: componentValue(func(component string) (string, error) {
+			return component, nil
+		}),
+	},
+	{
+		Name: "env",
+		Value: func(row *StatusRow) (string, error) {
+			return row.Workspace, nil
+		},
+	},
+	{
+		Name: "status",
+		Value: func(row *StatusRow) (string, error) {
+			return row.Status()
+		},
+	},
+	{
+		Name: "resources",
+		Value: func(row *StatusRow) (string, error) {
+			state, err := row.State()
+			if errors.Is(err, tf.ErrStatePull) {
+				// The status column already shows it as unknown.
+				return "", nil
+			}
+			if err != nil {
+				return "", err
+			}
+			return strconv.Itoa(state.CountResources()), nil
+		},
+	},
+	{
+		Name: "provider_resources",
+		Value: func(row *StatusRow) (string, error) {
+			state, err := row.State()
+			if errors.Is(err, tf.ErrStatePull) {
+				return "", nil
+			}
+			if err != nil {
+				return "", err
+			}
+			counts := state.CountResourcesByProvider()
+
+			providers := []string{}
+			for provider := range counts {
+				providers = append(providers, provider)
+			}
+			sort.Strings(providers)
+
+			values := []string{}
+			for _, provider := range providers {
+				values = append(values, fmt.Sprintf("%s=%d", provider, counts[provider]))
+			}
+			return strings.Join(values, " "), nil
+		},
+	},
+	{
+		Name: "last_applied",
+		Value: func(row *StatusRow) (string, error) {
+			wd, err := os.Getwd()
+			if err != nil {
+				return "", err
+			}
+
+			last, err := tf.LastApplied(wd, row.Component, row.Workspace)
+			if err != nil || last.IsZero() {
+				return "", err
+			}
+			return last.Local().Format("2006-01-02 15:04:05"), nil
+		},
+	},
+	{
+		Name:  "path",
+		Value: componentValue(filepath.Abs),
+	},
+	{
+		Name: "backend",
+		Value: componentValue(func(component string) (string, error) {
+			backend, err := tf.GetBackend(component)
+			return backend.String(), err
+		}),
+	},
+	{
+		Name:  "version",
+		Value: runnerValue(versionColumn),
+	},
+	{
+		Name:  "providers",
+		Value: runnerValue(providersColumn),
+	},
+	{
+		Name: "owner",
+		Value: componentValue(func(component string) (string, error) {
+			metadata, err := tf.GetMetadata(component)
+			return metadata.Owner, err
+		}),
+	},
+	{
+		Name: "tier",
+		Value: componentValue(func(component string) (string, error) {
+			metadata, err := tf.GetMetadata(component)
+			return metadata.Tier, err
+		}),
+	},
+	{
+		Name: "description",
+		Value: componentValue(func(component string) (string, error) {
+			metadata, err := tf.GetMetadata(component)
+			return metadata.Description, err
+		}),
+	},
+	{
+		Name: "labels",
+		Value: componentValue(func(component string) (string, error) {
+			metadata, err := tf.GetMetadata(component)
+			return metadata.LabelsString(), err
+		}),
+	},
+}
+
+// DefaultStatusColumns are the columns shown when --columns is not used.
+// The machine readable formats have more columns, since they are not
+// limited by the width of the terminal. When the components have
+// environments the env column is added after the name.
+const (
+	DefaultStatusColumns        = "name,status"
+	DefaultMachineStatusColumns = "name,status,resources,path"
+)
+
+// ParseStatusColumns returns the columns in the comma separated list,
+// reporting an error to the user if any of them is unknown.
+func ParseStatusColumns(list string) []StatusColumn {
+	columns := []StatusColumn{}
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+
+		for _, column := range StatusColumns {
+			if column.Name == name {
+				columns = append(columns, column)
+				found = true
+			}
+		}
+
+		if found == false {
+			names := []string{}
+			for _, column := range StatusColumns {
+				names = append(names, column.Name)
+			}
+			Error(fmt.Sprintf("Unknown column '%s', it should be one of: %s", name, strings.Join(names, ", ")))
+		}
+	}
+
+	return columns
+}
+
+// versionColumn returns the required_version of the component and whether
+// the terraform binary that runs in it satisfies it.
+func versionColumn(runner *tf.Runner, component string) (string, error) {
+	constraint, err := tf.RequiredVersion(component)
+	if err != nil || constraint == "" {
+		return constraint, err
+	}
+
+	binary, version, err := runner.ComponentVersion(component)
+	if err != nil {
+		return "", err
+	}
+	if version == "" {
+		return fmt.Sprintf("%s (%s not found)", constraint, binary), nil
+	}
+
+	ok, err := tf.VersionSatisfies(version, constraint)
+	if err != nil {
+		return fmt.Sprintf("%s (invalid)", constraint), nil
+	}
+	if ok == false {
+		return fmt.Sprintf("%s (%s doesn't match)", constraint, version), nil
+	}
+	if binary != runner.Binary {
+		// The binary of tf.yaml or an installed version runs instead.
+		return fmt.Sprintf("%s (uses %s)", constraint, version), nil
+	}
+
+	return fmt.Sprintf("%s (ok)", constraint), nil
+}
+
+// providersColumn returns the short names of the providers of the component
+// with their locked version (or their constraint if they are not locked).
+func providersColumn(runner *tf.Runner, component string) (string, error) {
+	providers, err := runner.Providers(component)
+	if err != nil {
+		return "", err
+	}
+
+	names := []string{}
+	for _, provider := range providers {
+		version := provider.Version
+		if version == "" {
+			version = provider.Constraint
+		}
+
+		names = append(names, strings.TrimSpace(provider.Name()+" "+version))
+	}
+
+	return strings.Join(names, ", "), nil
+}
+
+// ProviderRows returns one row for each provider of each component, with the
+// name of the component, the source of the provider, its constraint and its
+// locked version.
+func ProviderRows(runner *tf.Runner, components []string) [][]string {
+	rows := [][]string{}
+
+	for _, component := range components {
+		providers, err := runner.Providers(component)
+		if err != nil {
+			InternalError(fmt.Sprintf("Could not get the providers of '%s'", component), err)
+		}
+
+		for _, provider := range providers {
+			rows = append(rows, []string{component, provider.Source, provider.Constraint, provider.Version})
+		}
+	}
+
+	return rows
+}
+
+// Statuses are the statuses accepted by --only.
+var Statuses = []string{tf.StatusApplied, tf.StatusDestroyed, tf.StatusUnknown}
+
+// FilterByPattern returns the components that match the pattern, or all of
+// them if the pattern is empty.
+func FilterByPattern(components []string, pattern string) []string {
+	if pattern == "" {
+		return components
+	}
+
+	matched, err := tf.MatchComponents(tf.NormalizeComponent(pattern), components)
+	if err != nil {
+		Error(err.Error())
+	}
+
+	return matched
+}
+
+// FilterByLabels returns the components that have all the key=value labels
+// in their component.yaml.
+func FilterByLabels(components []string, labels []string) []string {
+	for _, label := range labels {
+		if strings.Contains(label, "=") == false {
+			Error(fmt.Sprintf("Invalid label '%s', it should be key=value", label))
+		}
+	}
+
+	if len(labels) == 0 {
+		return components
+	}
+
+	filtered := []string{}
+
+	for _, component := range components {
+		metadata, err := tf.GetMetadata(component)
+		if err != nil {
+			Error(err.Error())
+		}
+
+		if metadata.HasLabels(labels) {
+			filtered = append(filtered, component)
+		}
+	}
+
+	return filtered
+}
+
+// CmdStatus is run for the "status" command.
+func CmdStatus(args []string) {
+	fs := NewFlagSet("status")
+	AddEnvFlag(fs)
+	format := fs.String("format", FormatTable, "Output format: "+strings.Join(Formats, ", "))
+	columnList := fs.String("columns", DefaultStatusColumns, "Comma separated list of the columns to show")
+	showProviders := fs.Bool("providers", false, "Show the providers of every component instead of their status")
+	labels := StringList{}
+	fs.Var(&labels, "label", "Only show the components with this key=value label (can be repeated)")
+	jobs := fs.Int("jobs", runtime.NumCPU(), "Number of components to read at the same time")
+	only := fs.String("only", "", "Only show the components with this status: "+strings.Join(Statuses, ", "))
+	filter := fs.String("filter", "", "Only show the components that match this pattern, like 'network/*'")
+	watch := fs.Bool("watch", false, "Refresh the status every --interval, until Ctrl-C")
+	interval := fs.Duration("interval", 5*time.Second, "How often --watch refreshes the status")
+	ParseFlags(fs, args)
+
+	CheckFormat(*format, Formats)
+	if *only != "" && contains(Statuses, *only) == false {
+		Error(fmt.Sprintf("Unknown status '%s', it should be one of: %s", *only, strings.Join(Statuses, ", ")))
+	}
+	if *only != "" && *showProviders {
+		Error("--only can't be used with --providers")
+	}
+	if *format == FormatJSON || *format == FormatCSV || *format == FormatYAML {
+		if IsFlagSet(fs, "columns") == false {
+			*columnList = DefaultMachineStatusColumns
+		}
+	}
+
+	wd, components := FindComponents()
+	components = FilterByLabels(components, labels)
+	components = FilterByPattern(components, *filter)
+	config := LoadConfig(wd)
+
+	if (config.HasEnvironments() || environment != "") && IsFlagSet(fs, "columns") == false {
+		*columnList = strings.Replace(*columnList, "name,", "name,env,", 1)
+	}
+	columns := ParseStatusColumns(*columnList)
+
+	if *watch && *interval <= 0 {
+		Error("--interval has to be positive")
+	}
+
+	runner := NewRunner()
+
+	if *showProviders {
+		err := WriteRows(os.Stdout, *format, []string{"name", "provider", "constraint", "version"}, ProviderRows(runner, components))
+		if err != nil {
+			InternalError("Could not write the providers", err)
+		}
+		return
+	}
+
+	header := []string{}
+	for _, column := range columns {
+		header = append(header, column.Name)
+	}
+
+	// Every workspace of every component is a row.
+	names := []string{}
+	workspaces := []string{}
+	for _, component := range components {
+		componentConfig := config.Components[component]
+
+		if environment != "" {
+			if len(componentConfig.Environments) == 0 || contains(componentConfig.Environments, environment) {
+				names = append(names, component)
+				workspaces = append(workspaces, environment)
+			}
+			continue
+		}
+
+		for _, workspace := range componentConfig.Workspaces() {
+			names = append(names, component)
+			workspaces = append(workspaces, workspace)
+		}
+	}
+
+	if *watch == false {
+		WriteStatus(os.Stdout, runner, *format, header, columns, names, workspaces, *only, *jobs)
+		return
+	}
+
+	// The table is written to a buffer first, so that the screen is not
+	// blank while the components are read.
+	for {
+		var table bytes.Buffer
+		WriteStatus(&table, runner, *format, header, columns, names, workspaces, *only, *jobs)
+
+		fmt.Print(escClear)
+		fmt.Printf("Every %s: tf status (%s)\n\n", *interval, time.Now().Format("15:04:05"))
+		os.Stdout.Write(table.Bytes())
+
+		time.Sleep(*interval)
+	}
+}
+
+// WriteStatus writes the columns of the status of the workspaces of the
+// components in the format, reading jobs components at the same time with the
+// runner. If only is not empty, only the workspaces with that status are
+// written.
+func WriteStatus(w io.Writer, runner *tf.Runner, format string, header []string, columns []StatusColumn, names []string, workspaces []string, only string, jobs int) {
+	rows := make([][]string, len(names))
+	errs := make([]error, len(names))
+	skip := make([]bool, len(names))
+
+	tf.ParallelEach(names, jobs, func(i int, component string) {
+		row := &StatusRow{Runner: runner, Component: component, Workspace: workspaces[i]}
+
+		if only != "" {
+			status, err := row.Status()
+			if err != nil {
+				errs[i] = fmt.Errorf("could not get the status of '%s': %w", component, err)
+				return
+			}
+			if status != only {
+				skip[i] = true
+				return
+			}
+		}
+
+		for _, column := range columns {
+			value, err := column.Value(row)
+			if err != nil {
+				errs[i] = fmt.Errorf("could not get the %s of '%s': %w", column.Name, component, err)
+				return
+			}
+
+			rows[i] = append(rows[i], value)
+		}
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			InternalError("Could not get the status", err)
+		}
+	}
+
+	shown := [][]string{}
+	for i, row := range rows {
+		if skip[i] == false {
+			shown = append(shown, row)
+		}
+	}
+	rows = shown
+
+	if format == FormatTable && UseColor() {
+		for j, column := range columns {
+			if column.Name != "status" {
+				continue
+			}
+
+			for i := range rows {
+				rows[i][j] = ColorStatus(rows[i][j])
+			}
+		}
+	}
+
+	err := WriteRows(w, format, header, rows)
+	if err != nil {
+		InternalError("Could not write the status", err)
+	}
+}
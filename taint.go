@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+)
+
+// CmdTaint is run for the "taint" and "untaint" commands, which are the
+// same as terraform's.
+func CmdTaint(command string, args []string) {
+	fs := NewFlagSet(command)
+	AddEnvFlag(fs)
+	AddInitFlag(fs)
+	positional, terraformArgs := ParseFlagsWithTerraformArgs(fs, args)
+
+	component := ComponentArg(positional)
+	if len(positional) != 2 {
+		Error(fmt.Sprintf("The %s command needs the address of the resource, like in: tf %s %s aws_instance.main", command, command, component))
+	}
+
+	runner := NewRunner()
+	if err := EnsureInit(runner, component); err != nil {
+		Error(fmt.Sprintf("Could not initialize '%s': %s", component, err))
+	}
+
+	unlock, err := LockComponent(runner, component, command)
+	if err != nil {
+		Error(err.Error())
+	}
+
+	// terraform only accepts its options before the address.
+	taintArgs := append([]string{command}, terraformArgs...)
+	err = runner.Run(component, append(taintArgs, positional[1])...)
+	unlock()
+	ExitOnError(err)
+}
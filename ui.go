@@ -0,0 +1,398 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// The escape sequences used to draw the terminal UI.
+const (
+	escClear       = "\x1b[H\x1b[2J"
+	escReverse     = "\x1b[7m"
+	escReset       = "\x1b[0m"
+	escAltScreen   = "\x1b[?1049h\x1b[?25l"
+	escMainScreen  = "\x1b[?25h\x1b[?1049l"
+	keyUp          = "\x1b[A"
+	keyDown        = "\x1b[B"
+	uiListMinLines = 5
+)
+
+// UI is the state of the terminal UI of the "ui" command: the list of the
+// components with their status, and a pane with the output of the last
+// command that was run.
+type UI struct {
+	components []string
+	statuses   []string
+	cursor     int
+
+	// title and lines are the title and the output of the pane.
+	title string
+	lines []string
+	// partial is the last line of the output, until it is complete.
+	partial string
+
+	// message is shown at the bottom, instead of the help.
+	message string
+
+	rows, cols int
+
+	mu sync.Mutex
+}
+
+// CmdUI is run for the "ui" command.
+func CmdUI(args []string) {
+	fs := NewFlagSet("ui")
+	AddEnvFlag(fs)
+	ParseFlags(fs, args)
+
+	if _, err := exec.LookPath("stty"); err != nil {
+		Error("tf ui needs a terminal with stty, which was not found")
+	}
+
+	saved, err := stty("-g")
+	if err != nil {
+		Error("tf ui needs to be run in a terminal")
+	}
+
+	_, components := FindComponents()
+	if len(components) == 0 {
+		Error("No components found")
+	}
+
+	ui := &UI{components: components, title: "output"}
+	ui.refresh()
+
+	// Ctrl-C is still delivered as a signal, and HandleSignals has to
+	// restore the terminal before exiting.
+	restore := func() {
+		fmt.Print(escMainScreen)
+		stty(strings.TrimSpace(saved))
+	}
+	restoreTerminal = restore
+	confirm = ui.confirm
+
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		InternalError("Could not set up the terminal", err)
+	}
+	fmt.Print(escAltScreen)
+	defer restore()
+
+	ui.loop()
+}
+
+// loop reads the keys pressed by the user until they quit.
+func (u *UI) loop() {
+	for {
+		// The size is read only here, and not every time the output
+		// of a command is drawn, since it runs stty.
+		rows, cols := terminalSize()
+		u.mu.Lock()
+		u.rows, u.cols = rows, cols
+		u.mu.Unlock()
+
+		u.draw()
+
+		switch readKey() {
+		case "q":
+			return
+		case keyUp, "k":
+			u.move(-1)
+		case keyDown, "j":
+			u.move(1)
+		case "r":
+			u.setMessage("Refreshing the status...")
+			u.refresh()
+			u.setMessage("")
+		case "p":
+			u.plan(u.components[u.cursor])
+		case "a":
+			u.apply(u.components[u.cursor])
+		}
+	}
+}
+
+// refresh reads the status of all the components, in the workspace of --env.
+func (u *UI) refresh() {
+	statuses := make([]string, len(u.components))
+
+	workspace := tf.DefaultWorkspace
+	if environment != "" {
+		workspace = environment
+	}
+
+	runner, runnerErr := u.runner()
+
+	tf.ParallelEach(u.components, len(u.components), func(i int, component string) {
+		status, err := "", runnerErr
+		if err == nil {
+			status, err = runner.GetWorkspaceStatus(component, workspace)
+		}
+		if err != nil {
+			status = "error"
+		}
+		statuses[i] = status
+	})
+
+	u.mu.Lock()
+	u.statuses = statuses
+	u.mu.Unlock()
+}
+
+// move moves the cursor by delta components, without going out of the list.
+func (u *UI) move(delta int) {
+	u.cursor += delta
+	if u.cursor < 0 {
+		u.cursor = 0
+	}
+	if u.cursor >= len(u.components) {
+		u.cursor = len(u.components) - 1
+	}
+}
+
+// runner returns a runner whose output goes to the pane. Like everything run
+// by the UI, it returns the errors instead of exiting, which would leave the
+// terminal in raw mode.
+func (u *UI) runner() (*tf.Runner, error) {
+	runner, err := NewRunnerE()
+	if err != nil {
+		return nil, err
+	}
+	runner.Stdin = nil
+	runner.Stdout = u
+	runner.Stderr = u
+
+	return runner, nil
+}
+
+// plan runs the plan of the component, showing its output in the pane.
+func (u *UI) plan(component string) {
+	u.startPane("plan " + component)
+	runner, err := u.runner()
+	if err != nil {
+		u.finishPane(err)
+		return
+	}
+
+	err = WithHooks(runner, component, func() error {
+		err := runner.EnsureInit(component)
+		if err != nil {
+			return err
+		}
+
+		varArgs, err := VarArgsE(runner, component, []string{"-input=false", "-no-color"})
+		if err != nil {
+			return err
+		}
+
+		return runner.Run(component, append([]string{"plan"}, varArgs...)...)
+	})
+
+	u.finishPane(err)
+}
+
+// apply applies the component like "apply --review": the plan and the
+// context of the apply are shown in the pane, and it is only applied once the
+// user confirms it.
+func (u *UI) apply(component string) {
+	u.startPane("apply " + component)
+	runner, err := u.runner()
+	if err != nil {
+		u.finishPane(err)
+		return
+	}
+
+	err = ApplyComponent(runner, component, false, true, []string{"-input=false", "-no-color"})
+	if errors.Is(err, ErrApplyCancelled) {
+		u.setMessage("Apply cancelled.")
+		return
+	}
+
+	u.refresh()
+	u.finishPane(err)
+}
+
+// confirm asks the question at the bottom of the screen, returning true if
+// the user presses y.
+func (u *UI) confirm(question string) bool {
+	u.setMessage(question + " Press y to apply, any other key to cancel.")
+
+	return readKey() == "y"
+}
+
+// startPane clears the pane for a new command.
+func (u *UI) startPane(title string) {
+	u.mu.Lock()
+	u.title = title
+	u.lines = nil
+	u.partial = ""
+	u.message = ""
+	u.mu.Unlock()
+
+	u.draw()
+}
+
+// finishPane reports the result of the command of the pane.
+func (u *UI) finishPane(err error) {
+	if err != nil {
+		u.setMessage(fmt.Sprintf("'%s' failed: %s", u.title, err))
+	} else {
+		u.setMessage(fmt.Sprintf("'%s' succeeded.", u.title))
+	}
+}
+
+// setMessage sets the message shown at the bottom of the screen.
+func (u *UI) setMessage(message string) {
+	u.mu.Lock()
+	u.message = message
+	u.mu.Unlock()
+
+	u.draw()
+}
+
+// Write adds the output of the command to the pane, redrawing the screen so
+// that the output is shown while the command runs.
+func (u *UI) Write(p []byte) (int, error) {
+	u.mu.Lock()
+	for _, c := range string(p) {
+		switch c {
+		case '\n':
+			u.lines = append(u.lines, u.partial)
+			u.partial = ""
+		case '\r':
+			u.partial = ""
+		default:
+			u.partial += string(c)
+		}
+	}
+	u.mu.Unlock()
+
+	u.draw()
+	return len(p), nil
+}
+
+// draw draws the whole screen: the list of the components at the top, the
+// pane below it and the help (or the message) at the bottom.
+func (u *UI) draw() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	// The list takes up to half of the screen, the pane takes the rest.
+	listLines := len(u.components)
+	if listLines > u.rows/2 {
+		listLines = u.rows / 2
+	}
+	if listLines < uiListMinLines {
+		listLines = uiListMinLines
+	}
+	paneLines := u.rows - listLines - 4
+
+	var screen strings.Builder
+	screen.WriteString(escClear)
+
+	screen.WriteString(u.fit(fmt.Sprintf("tf ui - %d components", len(u.components))) + "\n")
+
+	first := 0
+	if u.cursor >= listLines {
+		first = u.cursor - listLines + 1
+	}
+
+	width := 0
+	for _, component := range u.components {
+		if len(component) > width {
+			width = len(component)
+		}
+	}
+
+	for i := first; i < first+listLines; i++ {
+		if i >= len(u.components) {
+			screen.WriteString("\n")
+			continue
+		}
+
+		line := u.fit(fmt.Sprintf("  %-*s  %s", width, u.components[i], u.statuses[i]))
+		if i == u.cursor {
+			line = escReverse + line + escReset
+		}
+		screen.WriteString(line + "\n")
+	}
+
+	screen.WriteString(u.fit("--- "+u.title+" "+strings.Repeat("-", u.cols)) + "\n")
+
+	lines := u.lines
+	if u.partial != "" {
+		lines = append(lines, u.partial)
+	}
+	if len(lines) > paneLines {
+		lines = lines[len(lines)-paneLines:]
+	}
+	for i := 0; i < paneLines; i++ {
+		if i < len(lines) {
+			screen.WriteString(u.fit(lines[i]))
+		}
+		screen.WriteString("\n")
+	}
+
+	footer := "up/down: select  p: plan  a: apply  r: refresh  q: quit"
+	if u.message != "" {
+		footer = u.message
+	}
+	screen.WriteString(escReverse + u.fit(footer) + escReset)
+
+	fmt.Print(screen.String())
+}
+
+// fit cuts the line to the width of the terminal.
+func (u *UI) fit(line string) string {
+	if u.cols > 0 && len(line) > u.cols {
+		return line[:u.cols]
+	}
+
+	return line
+}
+
+// readKey returns the next key pressed by the user, with the arrows as
+// their escape sequence.
+func readKey() string {
+	buf := make([]byte, 8)
+
+	n, err := os.Stdin.Read(buf)
+	if err != nil {
+		return "q"
+	}
+
+	return string(buf[:n])
+}
+
+// terminalSize returns the number of rows and columns of the terminal,
+// defaulting to 24x80 if stty can't tell.
+func terminalSize() (int, int) {
+	out, err := stty("size")
+	if err == nil {
+		fields := strings.Fields(out)
+		if len(fields) == 2 {
+			rows, errRows := strconv.Atoi(fields[0])
+			cols, errCols := strconv.Atoi(fields[1])
+			if errRows == nil && errCols == nil && rows > 0 && cols > 0 {
+				return rows, cols
+			}
+		}
+	}
+
+	return 24, 80
+}
+
+// stty runs stty on the terminal of the standard input.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+
+	out, err := cmd.Output()
+	return string(out), err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"runtime"
+
+	"github.com/fallertsen/tf/pkg/tf"
+)
+
+// CmdValidate is run for the "validate" command.
+func CmdValidate(args []string) {
+	fs := NewFlagSet("validate")
+	all := fs.Bool("all", false, "Validate all the components")
+	AddParallelFlag(fs)
+	AddInitFlag(fs)
+	positional := ParseFlags(fs, args)
+
+	// Validating doesn't change anything, so the components are validated
+	// at the same time unless --parallel says otherwise.
+	if IsFlagSet(fs, "parallel") == false {
+		parallel = runtime.NumCPU()
+	}
+
+	var order []string
+	if *all {
+		wd, components := FindComponents()
+		order = LoadGraph(wd, components).Order()
+	} else if len(positional) > 0 && tf.IsPattern(positional[0]) {
+		order = PatternGraph(positional[0]).Order()
+	} else {
+		order = []string{ComponentArg(positional)}
+		parallel = 1
+	}
+
+	noBlockers := func(string) []string { return nil }
+
+	results := RunComponents(NewRunner(), "Validating", order, noBlockers, func(runner *tf.Runner, component string) error {
+		return runner.Validate(component, noInit == false)
+	})
+
+	if PrintSummary(results) == false {
+		os.Exit(1)
+	}
+}